@@ -0,0 +1,641 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/samber/lo"
+)
+
+const usage = `Usage: generator <command> [flags] [inputs...]
+
+Commands:
+  generate   render the service code for the given schema files
+  validate   check schema files without generating anything
+  diff       show what generate would change, without writing (generate --dry-run)
+  init       write a starter schema file
+  schema     print the JSON Schema for entity files
+  migrate    write SQL migrations for the schema
+
+Inputs are schema files, directories or quoted glob patterns.
+Run "generator <command> -h" for the flags of a command.
+
+The pre-subcommand form "generator <input> [output_directory]" still works
+and is the same as "generator generate -o <output_directory> <input>".
+`
+
+// Exit statuses
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// run executes the command line and returns the process exit status
+func run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "generate":
+		return runGenerate(args[1:], false)
+	case "diff":
+		return runGenerate(args[1:], true)
+	case "validate":
+		return runValidate(args[1:])
+	case "init":
+		return runInit(args[1:])
+	case "schema":
+		return runSchema(args[1:])
+	case "migrate":
+		return runMigrate(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return exitOK
+	}
+
+	if strings.HasPrefix(args[0], "-") || len(args) > 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+	legacy := []string{args[0]}
+	if len(args) == 2 {
+		legacy = append(legacy, "-o", args[1])
+	}
+	return runGenerate(legacy, false)
+}
+
+// generateOptions holds the flags shared by generate and diff
+type generateOptions struct {
+	outputDir   string
+	moduleName  string
+	templateDir string
+	force       bool
+	dryRun      bool
+	exitCode    bool
+	workers     int
+	prune       bool
+	// pruneUserOwned also removes the user owned files of removed entities
+	pruneUserOwned bool
+	verbose        bool
+	quiet          bool
+}
+
+func newFlagSet(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: generator %s\n\nFlags:\n", synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args allowing flags and positional arguments to be mixed,
+// so "generate schema/ -o out" works as well as "generate -o out schema/"
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// usageError reports a parse failure; -h is not a failure
+func usageError(err error) int {
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	return exitUsage
+}
+
+func addVerbosityFlags(fs *flag.FlagSet, verbose, quiet *bool) {
+	fs.BoolVar(verbose, "v", false, "print every file and warning as it is handled")
+	fs.BoolVar(verbose, "verbose", false, "same as -v")
+	fs.BoolVar(quiet, "q", false, "only print errors")
+	fs.BoolVar(quiet, "quiet", false, "same as -q")
+}
+
+// loadSchema parses and validates the inputs. Diagnostics go to stderr; warnings
+// are dropped in quiet mode. It returns false when any error was reported.
+func loadSchema(inputs []string, quiet bool) ([]Entity, bool) {
+	entities, err := parseInputs(inputs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing input: %v\n", err)
+		return nil, false
+	}
+
+	diagnostics := validateEntities(entities)
+	for _, d := range diagnostics {
+		if !d.Warning || !quiet {
+			fmt.Fprintln(os.Stderr, d)
+		}
+	}
+	return entities, !lo.SomeBy(diagnostics, func(d diagnostic) bool { return !d.Warning })
+}
+
+func runGenerate(args []string, dryRun bool) int {
+	name := "generate"
+	if dryRun {
+		name = "diff"
+	}
+	fs := newFlagSet(name, name+" [flags] <input>...")
+	opts := generateOptions{dryRun: dryRun}
+	fs.StringVar(&opts.outputDir, "o", "output", "output directory")
+	fs.StringVar(&opts.outputDir, "output", "output", "same as -o")
+	fs.StringVar(&opts.moduleName, "module", "", "Go import path of the output directory (default $MODULE_NAME, then the enclosing go.mod)")
+	fs.StringVar(&opts.templateDir, "templates", "", "directory of templates that replace the built-in ones with the same file name")
+	fs.BoolVar(&opts.force, "force", false, "overwrite user owned files that already exist")
+	fs.BoolVar(&opts.dryRun, "dry-run", dryRun, "render everything and print what would change, but write nothing")
+	fs.IntVar(&opts.workers, "j", runtime.NumCPU(), "number of files to render in parallel")
+	fs.BoolVar(&opts.prune, "prune", false, "delete generated files of entities no longer in the schema")
+	fs.BoolVar(&opts.pruneUserOwned, "prune-user-owned", false, "with --prune, also delete their user owned files")
+	fs.BoolVar(&opts.exitCode, "exit-code", false, "with --dry-run, exit with status 1 when any file would be created or modified")
+	addVerbosityFlags(fs, &opts.verbose, &opts.quiet)
+
+	inputs, err := parseFlags(fs, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(inputs) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	// Load environment variables from .env file
+	if err := godotenv.Load(); err != nil && opts.verbose {
+		// .env file is optional, so we don't fail if it doesn't exist
+		fmt.Println("Warning: .env file not found, using default values")
+	}
+
+	moduleName, err := resolveModuleName(opts.moduleName, opts.outputDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	if opts.templateDir != "" {
+		overrides, unknown, err := templateOverrides(opts.templateDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		for _, name := range unknown {
+			fmt.Fprintf(os.Stderr, "Warning: %s matches no built-in template and is ignored\n", filepath.Join(opts.templateDir, name))
+		}
+		if opts.verbose {
+			for _, name := range overrides {
+				fmt.Printf("Using %s\n", filepath.Join(opts.templateDir, name))
+			}
+		}
+	}
+
+	entities, ok := loadSchema(inputs, opts.quiet)
+	if !ok {
+		return exitError
+	}
+
+	g := &generator{
+		outputDir:   opts.outputDir,
+		moduleName:  moduleName,
+		templateDir: opts.templateDir,
+		force:       opts.force,
+		dryRun:      opts.dryRun,
+		verbose:     opts.verbose,
+		quiet:       opts.quiet,
+		counts:      map[fileStatus]int{},
+		workers:     opts.workers,
+
+		prune:          opts.prune || opts.pruneUserOwned,
+		pruneUserOwned: opts.pruneUserOwned,
+	}
+	if !g.run(entities) {
+		return exitError
+	}
+	if opts.exitCode && g.counts[fileCreated]+g.counts[fileModified]+g.counts[fileConflict]+g.counts[fileDeleted] > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+func runValidate(args []string) int {
+	fs := newFlagSet("validate", "validate [flags] <input>...")
+	var verbose, quiet bool
+	addVerbosityFlags(fs, &verbose, &quiet)
+
+	inputs, err := parseFlags(fs, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(inputs) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	entities, ok := loadSchema(inputs, quiet)
+	if !ok {
+		return exitError
+	}
+	if !quiet {
+		fmt.Printf("%d entities OK\n", len(entities))
+	}
+	return exitOK
+}
+
+func runSchema(args []string) int {
+	fs := newFlagSet("schema", "schema [flags]")
+	output := fs.String("o", "", "write the schema to this file instead of stdout")
+	if positional, err := parseFlags(fs, args); err != nil {
+		return usageError(err)
+	} else if len(positional) > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	schema, err := inputJSONSchema()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building schema: %v\n", err)
+		return exitError
+	}
+	if *output == "" {
+		fmt.Println(string(schema))
+		return exitOK
+	}
+	if err := os.WriteFile(*output, append(schema, '\n'), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing schema: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+const migrateUsage = `Usage: generator migrate <command> [flags] <input>...
+
+Commands:
+  init   write the migration creating every table of the schema
+  diff   write the migration from the schema of the last migration to the current one
+
+Migrations are Postgres SQL in the layout of golang-migrate or goose.
+`
+
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "init":
+		return runMigrateInit(args[1:])
+	case "diff":
+		return runMigrateDiff(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(migrateUsage)
+		return exitOK
+	}
+	fmt.Fprint(os.Stderr, migrateUsage)
+	return exitUsage
+}
+
+// migrateOptions holds the flags shared by the migrate commands
+type migrateOptions struct {
+	dir    string
+	format string
+	name   string
+	dryRun bool
+	quiet  bool
+}
+
+func addMigrateFlags(fs *flag.FlagSet, opts *migrateOptions, name string) {
+	fs.StringVar(&opts.dir, "d", "migrations", "directory of the migration files")
+	fs.StringVar(&opts.dir, "dir", "migrations", "same as -d")
+	fs.StringVar(&opts.format, "format", formatGolangMigrate, "file layout: "+strings.Join(migrationFormats, " or "))
+	fs.StringVar(&opts.name, "name", name, "name of the migration, after its version in the file name")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "print the migration instead of writing it")
+	fs.BoolVar(&opts.quiet, "q", false, "only print errors")
+	fs.BoolVar(&opts.quiet, "quiet", false, "same as -q")
+}
+
+func runMigrateInit(args []string) int {
+	fs := newFlagSet("migrate init", "migrate init [flags] <input>...")
+	var opts migrateOptions
+	addMigrateFlags(fs, &opts, "init")
+	inputs, err := parseFlags(fs, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(inputs) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if !lo.Contains(migrationFormats, opts.format) {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q, expected %s\n", opts.format, strings.Join(migrationFormats, " or "))
+		return exitUsage
+	}
+
+	entities, ok := loadSchema(inputs, opts.quiet)
+	if !ok {
+		return exitError
+	}
+	latest, err := latestMigrationVersion(opts.dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading migrations: %v\n", err)
+		return exitError
+	}
+	if latest > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s already has migrations up to version %d\n", opts.dir, latest)
+		return exitError
+	}
+
+	AssignRelations(entities)
+	schema := buildSQLSchema(entities)
+	up, down := renderCreateSchema(schema)
+	snapshot := &schemaSnapshot{Version: snapshotVersion, Migration: 1, Schema: schema}
+	if err := writeMigration(opts.dir, migrationFiles(opts.format, 1, lo.SnakeCase(opts.name), up, down), snapshot, opts.dryRun, opts.quiet); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func runMigrateDiff(args []string) int {
+	fs := newFlagSet("migrate diff", "migrate diff [flags] <input>...")
+	var opts migrateOptions
+	addMigrateFlags(fs, &opts, "update")
+	allowDestructive := fs.Bool("allow-destructive", false, "write the migration even if it drops data or may fail on existing rows")
+	inputs, err := parseFlags(fs, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(inputs) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if !lo.Contains(migrationFormats, opts.format) {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q, expected %s\n", opts.format, strings.Join(migrationFormats, " or "))
+		return exitUsage
+	}
+
+	entities, ok := loadSchema(inputs, opts.quiet)
+	if !ok {
+		return exitError
+	}
+	previous, err := loadSnapshot(opts.dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if previous == nil {
+		fmt.Fprintf(os.Stderr, "Error: %s has no %s, run migrate init first\n", opts.dir, snapshotName)
+		return exitError
+	}
+	latest, err := latestMigrationVersion(opts.dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading migrations: %v\n", err)
+		return exitError
+	}
+	if latest > previous.Migration && !opts.quiet {
+		fmt.Fprintf(os.Stderr, "Warning: migrations after version %d were written by hand, the diff doesn't account for them\n", previous.Migration)
+	}
+
+	AssignRelations(entities)
+	schema := buildSQLSchema(entities)
+	up := diffSchemas(previous.Schema, schema)
+	if len(up.statements) == 0 {
+		if !opts.quiet {
+			fmt.Println("The schema has not changed since the last migration")
+		}
+		return exitOK
+	}
+	for _, reason := range up.destructive {
+		fmt.Fprintf(os.Stderr, "Warning: destructive change: %s\n", reason)
+	}
+	if len(up.destructive) > 0 && !*allowDestructive && !opts.dryRun {
+		fmt.Fprintln(os.Stderr, "Error: the migration has destructive changes, review them and pass --allow-destructive to write it")
+		return exitError
+	}
+
+	down := diffSchemas(schema, previous.Schema)
+	version := max(latest, previous.Migration) + 1
+	files := migrationFiles(opts.format, version, lo.SnakeCase(opts.name), joinStatements(up.statements), joinStatements(down.statements))
+	snapshot := &schemaSnapshot{Version: snapshotVersion, Migration: version, Schema: schema}
+	if err := writeMigration(opts.dir, files, snapshot, opts.dryRun, opts.quiet); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func runInit(args []string) int {
+	fs := newFlagSet("init", "init [flags] [directory]")
+	schemaFormat := fs.String("format", "json", "format of the starter schema: json, yaml or hcl")
+	moduleName := fs.String("module", "", "also write a .env setting MODULE_NAME to this import path")
+	force := fs.Bool("force", false, "overwrite files that already exist")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	dir := "."
+	if len(positional) == 1 {
+		dir = positional[0]
+	}
+
+	starter, ok := starterSchemas[*schemaFormat]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q, expected json, yaml or hcl\n", *schemaFormat)
+		return exitUsage
+	}
+
+	files := map[string]string{filepath.Join(dir, "entities."+*schemaFormat): starter}
+	if *moduleName != "" {
+		files[filepath.Join(dir, ".env")] = fmt.Sprintf("MODULE_NAME=%s\n", *moduleName)
+	}
+	for file := range files {
+		if fileExists(file) && !*force {
+			fmt.Fprintf(os.Stderr, "Error: %s already exists, pass --force to overwrite it\n", file)
+			return exitError
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating directory %s: %v\n", dir, err)
+		return exitError
+	}
+	names := lo.Keys(files)
+	sort.Strings(names)
+	for _, file := range names {
+		if err := os.WriteFile(file, []byte(files[file]), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", file, err)
+			return exitError
+		}
+		fmt.Printf("Wrote %s\n", file)
+	}
+	return exitOK
+}
+
+// resolveModuleName picks the import path of the output directory: the flag,
+// then MODULE_NAME, then the module of the go.mod enclosing the output directory
+func resolveModuleName(flagValue, outputDir string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if env := os.Getenv("MODULE_NAME"); env != "" {
+		return env, nil
+	}
+
+	dir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return "", err
+	}
+	for current := dir; ; current = filepath.Dir(current) {
+		if modulePath, ok := readModulePath(filepath.Join(current, "go.mod")); ok {
+			rel, err := filepath.Rel(current, dir)
+			if err != nil {
+				return "", err
+			}
+			if rel == "." {
+				return modulePath, nil
+			}
+			return modulePath + "/" + filepath.ToSlash(rel), nil
+		}
+		if filepath.Dir(current) == current {
+			break
+		}
+	}
+	return "", fmt.Errorf("cannot determine the module path of %s: pass --module, set MODULE_NAME or generate inside a Go module", outputDir)
+}
+
+// readModulePath returns the module directive of a go.mod file
+func readModulePath(goMod string) (string, bool) {
+	file, err := os.Open(goMod)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(line, "module"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			return strings.Trim(strings.TrimSpace(rest), `"`), true
+		}
+	}
+	return "", false
+}
+
+// starterSchemas holds the schema written by init, one per input format
+var starterSchemas = map[string]string{
+	"json": `[
+  {
+    "entityName": "Author",
+    "fields": [
+      { "fieldName": "id", "fieldType": "uuid", "primary": true },
+      { "fieldName": "name", "fieldType": "string", "searchable": true, "minLength": 1 },
+      { "fieldName": "email", "fieldType": "string", "unique": true, "email": true }
+    ],
+    "relations": [
+      { "relationType": "OneToMany", "relatedEntity": "Post", "fieldName": "posts" }
+    ],
+    "additionalFeatures": { "pagination": true, "sorting": true }
+  },
+  {
+    "entityName": "Post",
+    "fields": [
+      { "fieldName": "id", "fieldType": "uuid", "primary": true },
+      { "fieldName": "title", "fieldType": "string", "searchable": true, "filterBy": true },
+      { "fieldName": "status", "fieldType": "enum", "values": ["draft", "published"], "filterBy": true }
+    ],
+    "relations": [
+      { "relationType": "ManyToOne", "relatedEntity": "Author", "fieldName": "author" }
+    ],
+    "additionalFeatures": { "pagination": true, "sorting": true, "softDelete": true }
+  }
+]
+`,
+	"yaml": `- entityName: Author
+  fields:
+    - { fieldName: id, fieldType: uuid, primary: true }
+    - { fieldName: name, fieldType: string, searchable: true, minLength: 1 }
+    - { fieldName: email, fieldType: string, unique: true, email: true }
+  relations:
+    - { relationType: OneToMany, relatedEntity: Post, fieldName: posts }
+  additionalFeatures: { pagination: true, sorting: true }
+
+- entityName: Post
+  fields:
+    - { fieldName: id, fieldType: uuid, primary: true }
+    - { fieldName: title, fieldType: string, searchable: true, filterBy: true }
+    - { fieldName: status, fieldType: enum, values: [draft, published], filterBy: true }
+  relations:
+    - { relationType: ManyToOne, relatedEntity: Author, fieldName: author }
+  additionalFeatures: { pagination: true, sorting: true, softDelete: true }
+`,
+	"hcl": `entity "Author" {
+  field "id" {
+    fieldType = "uuid"
+    primary   = true
+  }
+  field "name" {
+    fieldType  = "string"
+    searchable = true
+    minLength  = 1
+  }
+  field "email" {
+    fieldType = "string"
+    unique    = true
+    email     = true
+  }
+  relation "posts" {
+    relationType  = "OneToMany"
+    relatedEntity = "Post"
+  }
+  additionalFeatures {
+    pagination = true
+    sorting    = true
+  }
+}
+
+entity "Post" {
+  field "id" {
+    fieldType = "uuid"
+    primary   = true
+  }
+  field "title" {
+    fieldType  = "string"
+    searchable = true
+    filterBy   = true
+  }
+  field "status" {
+    fieldType = "enum"
+    values    = ["draft", "published"]
+    filterBy  = true
+  }
+  relation "author" {
+    relationType  = "ManyToOne"
+    relatedEntity = "Author"
+  }
+  additionalFeatures {
+    pagination = true
+    sorting    = true
+    softDelete = true
+  }
+}
+`,
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Input types matching the design tool export: an entities map keyed by name
+// plus a flat relationships array
+type designField struct {
+	Type       string   `json:"type"`
+	PrimaryKey bool     `json:"primaryKey"`
+	Unique     bool     `json:"unique"`
+	Searchable bool     `json:"searchable"`
+	Nullable   bool     `json:"nullable"`
+	FilterBy   bool     `json:"filterBy"`
+	Virtual    bool     `json:"virtual"`
+	Values     []string `json:"values"`
+}
+
+type designRelationship struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	FromField     string `json:"fromField"`
+	ToField       string `json:"toField"`
+	Cascade       bool   `json:"cascade"`
+	ForeignKey    string `json:"foreignKey"`
+	OneToOneOwner bool   `json:"oneToOneOwner"`
+}
+
+type designSchema struct {
+	Entities      json.RawMessage      `json:"entities"`
+	Relationships []designRelationship `json:"relationships"`
+}
+
+// isDesignSchema reports whether the input is a design tool export rather than
+// an entity array or a single entity
+func isDesignSchema(data []byte) bool {
+	var probe designSchema
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	entities := bytes.TrimSpace(probe.Entities)
+	return len(entities) > 0 && entities[0] == '{'
+}
+
+// parseDesignSchema converts a design tool export into entities. Fields ending in
+// an _id column are skipped since the relations generate them, and relationships
+// are attached to the entity they start from.
+func parseDesignSchema(data []byte) ([]Entity, error) {
+	var schema designSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("error parsing design schema: %v", err)
+	}
+
+	entityNames, entityData, err := decodeOrderedObject(schema.Entities)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing design schema entities: %v", err)
+	}
+
+	entities := make([]Entity, 0, len(entityNames))
+	for _, entityName := range entityNames {
+		var definition struct {
+			Fields json.RawMessage `json:"fields"`
+		}
+		if err := json.Unmarshal(entityData[entityName], &definition); err != nil {
+			return nil, fmt.Errorf("error parsing entity %s: %v", entityName, err)
+		}
+
+		fieldNames, fieldData, err := decodeOrderedObject(definition.Fields)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing fields of entity %s: %v", entityName, err)
+		}
+
+		entity := Entity{
+			EntityName: entityName,
+			ModuleName: strings.ToLower(entityName),
+			Fields:     []Field{},
+			Relations:  []Relation{},
+			source:     schemaLocation{Pointer: "/entities/" + jsonPointerToken(entityName)},
+		}
+
+		for _, fieldName := range fieldNames {
+			if strings.Contains(fieldName, "_id") {
+				continue
+			}
+			var f designField
+			if err := json.Unmarshal(fieldData[fieldName], &f); err != nil {
+				return nil, fmt.Errorf("error parsing field %s.%s: %v", entityName, fieldName, err)
+			}
+
+			field := Field{
+				FieldName:  snakeToCamel(fieldName),
+				FieldType:  designFieldType(f.Type),
+				Primary:    f.PrimaryKey,
+				Unique:     f.Unique,
+				Searchable: f.Searchable,
+				Nullable:   f.Nullable,
+				FilterBy:   f.FilterBy,
+				Virtual:    f.Virtual,
+			}
+			// Keep enum values so the field becomes a named type instead of a plain string
+			if f.Type == "enum" && len(f.Values) > 0 {
+				field.FieldType = "enum"
+				field.Values = f.Values
+			}
+			entity.Fields = append(entity.Fields, field)
+			entity.source.Fields = append(entity.source.Fields, entity.source.Pointer+"/fields/"+jsonPointerToken(fieldName))
+		}
+
+		for r, rel := range schema.Relationships {
+			if rel.From != entityName {
+				continue
+			}
+			relation := Relation{
+				RelationType:  designRelationType(rel.Type),
+				RelatedEntity: rel.To,
+				FieldName:     lowerFirst(rel.Name),
+				Cascade:       rel.Cascade,
+				OneToOneOwner: rel.OneToOneOwner,
+			}
+			if rel.Type == "one-to-many" {
+				parts := strings.Split(rel.ToField, "_")
+				relation.ForeignKey = lowerFirst(strings.Join(parts[:len(parts)-1], "_"))
+			}
+			if rel.ForeignKey != "" {
+				relation.ForeignKey = rel.ForeignKey
+			}
+			entity.Relations = append(entity.Relations, relation)
+			entity.source.Relations = append(entity.source.Relations, fmt.Sprintf("/relationships/%d", r))
+		}
+
+		entities = append(entities, entity)
+	}
+
+	return entities, nil
+}
+
+// designFieldType maps design tool column types onto the generator's field types
+func designFieldType(fieldType string) string {
+	switch fieldType {
+	case "uuid", "string", "text", "point", "enum", "interval":
+		return "string"
+	case "number", "integer":
+		return "number"
+	case "decimal":
+		return "decimal"
+	case "boolean":
+		return "boolean"
+	case "date", "timestamp":
+		return "date"
+	case "jsonb":
+		return "jsonb"
+	default:
+		return fieldType
+	}
+}
+
+func designRelationType(relationType string) string {
+	switch relationType {
+	case "one-to-one":
+		return "OneToOne"
+	case "many-to-one":
+		return "ManyToOne"
+	case "many-to-many":
+		return "ManyToMany"
+	default:
+		return "OneToMany"
+	}
+}
+
+var snakeSegment = regexp.MustCompile(`_([a-z])`)
+
+// snakeToCamel upper cases every lowercase letter that follows an underscore
+func snakeToCamel(s string) string {
+	return snakeSegment.ReplaceAllStringFunc(s, func(m string) string {
+		return strings.ToUpper(m[1:])
+	})
+}
+
+func lowerFirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// decodeOrderedObject decodes a JSON object and returns its keys in document
+// order, so generated files follow the order of the schema
+func decodeOrderedObject(data []byte) ([]string, map[string]json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, nil, fmt.Errorf("expected an object")
+	}
+
+	var keys []string
+	values := make(map[string]json.RawMessage)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		if _, exists := values[key]; !exists {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+
+	return keys, values, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestParseDesignSchemaMatchesConvertJS checks the importer against the output
+// convert.js, the preprocessing script it replaced, gave for the same files.
+// The testdata/*.convert.json files were written by that script.
+func TestParseDesignSchemaMatchesConvertJS(t *testing.T) {
+	tests := []struct {
+		input, converted string
+	}{
+		{"example_json", "testdata/example_json.convert.json"},
+		{"testdata/design_edge.json", "testdata/design_edge.convert.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.input), func(t *testing.T) {
+			data, err := os.ReadFile(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isDesignSchema(data) {
+				t.Fatalf("%s is not recognized as a design schema", tt.input)
+			}
+			got, err := parseDesignSchema(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range got {
+				got[i].source = schemaLocation{}
+			}
+
+			converted, err := os.ReadFile(tt.converted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []Entity
+			if err := json.Unmarshal(converted, &want); err != nil {
+				t.Fatal(err)
+			}
+			applyImporterChanges(t, data, want)
+
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.MarshalIndent(got, "", "  ")
+				wantJSON, _ := json.MarshalIndent(want, "", "  ")
+				t.Errorf("parseDesignSchema:\n%s\nwant:\n%s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+// applyImporterChanges updates the convert.js output with the two deliberate
+// differences of the importer: jsonb columns stay jsonb instead of becoming
+// "object", which no template understands, and enum values are kept.
+func applyImporterChanges(t *testing.T, data []byte, entities []Entity) {
+	t.Helper()
+	var schema struct {
+		Entities map[string]struct {
+			Fields map[string]designField `json:"fields"`
+		} `json:"entities"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range entities {
+		designFields := map[string]designField{}
+		for name, field := range schema.Entities[entities[i].EntityName].Fields {
+			designFields[snakeToCamel(name)] = field
+		}
+		for j := range entities[i].Fields {
+			field := &entities[i].Fields[j]
+			design := designFields[field.FieldName]
+			if design.Type == "jsonb" {
+				field.FieldType = "jsonb"
+			}
+			if design.Type == "enum" && len(design.Values) > 0 {
+				field.FieldType = "enum"
+				field.Values = design.Values
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// fileStatus describes what a run does to one output file
+type fileStatus string
+
+const (
+	fileCreated   fileStatus = "created"
+	fileModified  fileStatus = "modified"
+	fileUnchanged fileStatus = "unchanged"
+	// fileSkipped marks user owned files that already exist and are left alone
+	fileSkipped fileStatus = "skipped"
+	// fileConflict marks generated files edited by hand, which are not overwritten
+	fileConflict fileStatus = "conflict"
+	// fileDeleted marks files of entities removed from the schema that are pruned
+	fileDeleted fileStatus = "deleted"
+)
+
+var fileStatuses = []fileStatus{fileCreated, fileModified, fileUnchanged, fileSkipped, fileConflict, fileDeleted}
+
+// compareOutput classifies rendered content against what is on disk
+func compareOutput(filePath string, rendered []byte) (fileStatus, []byte, error) {
+	existing, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return fileCreated, nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading existing file: %v", err)
+	}
+	if string(existing) == string(rendered) {
+		return fileUnchanged, existing, nil
+	}
+	return fileModified, existing, nil
+}
+
+// report records the status of a file and prints it. Dry runs label every file
+// and show a unified diff for modified and conflicting ones; normal runs only
+// label deletions, or every file when verbose.
+func (g *generator) report(filePath string, status fileStatus, existing, rendered []byte) {
+	g.counts[status]++
+	if g.quiet || !(g.dryRun || g.verbose || status == fileDeleted) {
+		return
+	}
+
+	note := ""
+	switch status {
+	case fileSkipped:
+		note = " (user owned)"
+	case fileConflict:
+		note = " (edited by hand)"
+	}
+	fmt.Printf("%-10s %s%s\n", status, filePath, note)
+
+	if g.dryRun && (status == fileModified || status == fileConflict) {
+		name, err := filepath.Rel(g.outputDir, filePath)
+		if err != nil {
+			name = filePath
+		}
+		diff, err := unifiedDiff(filepath.ToSlash(name), existing, rendered)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error diffing %s: %v\n", filePath, err)
+			return
+		}
+		fmt.Print(diff)
+	}
+}
+
+// summary counts the files per status, e.g. "2 created, 1 modified, 40 unchanged"
+func (g *generator) summary() string {
+	var parts []string
+	for _, status := range fileStatuses {
+		if g.counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", g.counts[status], status))
+		}
+	}
+	if len(parts) == 0 {
+		return "no files"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func unifiedDiff(filePath string, before, after []byte) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(before)),
+		B:        difflib.SplitLines(string(after)),
+		FromFile: "a/" + filePath,
+		ToFile:   "b/" + filePath,
+		Context:  3,
+	})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// generatedGoMod pins the dependencies of the generated service, so the build
+// below works from the module cache without resolving newer versions
+const generatedGoMod = `module example.com/service
+
+require (
+	github.com/gin-contrib/cors v1.7.7
+	github.com/gin-gonic/gin v1.12.0
+	github.com/go-playground/validator/v10 v10.30.5
+	github.com/golang-jwt/jwt/v5 v5.3.1
+	github.com/google/uuid v1.6.0
+	github.com/google/wire v0.7.0
+	github.com/samber/lo v1.53.0
+	golang.org/x/crypto v0.57.0
+	gorm.io/driver/postgres v1.6.3
+	gorm.io/driver/sqlite v1.6.0
+	gorm.io/gorm v1.31.2
+)
+`
+
+// TestGeneratedCodeBuilds generates a service from the sample schema and from
+// the starter schema of init, and builds and vets the result
+func TestGeneratedCodeBuilds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated code")
+	}
+
+	starter := filepath.Join(t.TempDir(), "entities.json")
+	if err := os.WriteFile(starter, []byte(starterSchemas["json"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, input := range map[string]string{"input.json": "input.json", "init": starter} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			generateService(t, dir, input)
+			checkRuleTags(t, dir)
+			tidyService(t, dir)
+			buildService(t, dir)
+		})
+	}
+}
+
+// TestGeneratedServiceBehaviour runs testdata/service/service_test.go in the
+// service generated from testdata/service/schema.json
+func TestGeneratedServiceBehaviour(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and tests the generated code")
+	}
+	if out, err := exec.Command("go", "env", "CGO_ENABLED").Output(); err != nil || strings.TrimSpace(string(out)) != "1" {
+		t.Skip("the SQLite driver needs cgo")
+	}
+
+	dir := t.TempDir()
+	generateService(t, dir, "testdata/service/schema.json")
+	tests, err := os.ReadFile("testdata/service/service_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "service_test.go"), tests, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tidyService(t, dir)
+	if out, err := goCommand(dir, "test", "./..."); err != nil {
+		t.Fatalf("go test: %v\n%s", err, out)
+	}
+}
+
+// TestRegeneratedServiceBuilds changes the schema of an existing service step
+// by step, and checks that refreshing its user owned files keeps it building
+func TestRegeneratedServiceBuilds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated code")
+	}
+
+	note := `{"entityName": "Note", "fields": [
+		{"fieldName": "id", "fieldType": "uuid", "primary": true},
+		{"fieldName": "title", "fieldType": "string"}%s
+	], "additionalFeatures": {%s}}`
+	dateFilter := `,
+		{"fieldName": "dueAt", "fieldType": "date", "nullable": true, "filterBy": true}`
+	// The auth scaffold signs up users with the fields of SignUpInput
+	user := `{"entityName": "User", "fields": [
+		{"fieldName": "ID", "fieldType": "uuid", "primary": true},
+		{"fieldName": "email", "fieldType": "string", "nullable": true, "unique": true},
+		{"fieldName": "phoneNumber", "fieldType": "string", "nullable": true},
+		{"fieldName": "passwordHash", "fieldType": "string", "nullable": true},
+		{"fieldName": "fullName", "fieldType": "string"},
+		{"fieldName": "userType", "fieldType": "string", "nullable": true},
+		{"fieldName": "address", "fieldType": "string", "nullable": true},
+		{"fieldName": "state", "fieldType": "string", "nullable": true},
+		{"fieldName": "city", "fieldType": "string", "nullable": true},
+		{"fieldName": "isVerified", "fieldType": "boolean", "nullable": true},
+		{"fieldName": "verificationStatus", "fieldType": "string", "nullable": true},
+		{"fieldName": "isActive", "fieldType": "boolean", "nullable": true}
+	]}`
+	steps := []struct {
+		name     string
+		entities []string
+	}{
+		{"initial", []string{fmt.Sprintf(note, "", "")}},
+		{"date filter added", []string{fmt.Sprintf(note, dateFilter, "")}},
+		{"date filter removed", []string{fmt.Sprintf(note, "", "")}},
+		{"user added", []string{user, fmt.Sprintf(note, "", "")}},
+		{"authentication required", []string{user, fmt.Sprintf(note, "", `"authenticationRequired": true`)}},
+	}
+
+	dir := t.TempDir()
+	schema := filepath.Join(t.TempDir(), "schema.json")
+	for _, step := range steps {
+		if err := os.WriteFile(schema, []byte("["+strings.Join(step.entities, ",")+"]"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		generateService(t, dir, schema)
+		tidyService(t, dir)
+		// wire.go only builds with the tag wire generates the injector with
+		for _, args := range [][]string{{"build", "./..."}, {"vet", "-tags", "wireinject", "."}} {
+			if out, err := goCommand(dir, args...); err != nil {
+				t.Fatalf("%s: go %s: %v\n%s", step.name, args[0], err, out)
+			}
+		}
+	}
+}
+
+// generateService generates input into dir, next to a go.mod with the pinned
+// dependencies. Generating into a dir that already holds a service refreshes it.
+func generateService(t *testing.T, dir, input string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(generatedGoMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := run([]string{"generate", "-q", "-o", dir, "--module", "example.com/service", input}); code != exitOK {
+		t.Fatalf("generate exited with status %d", code)
+	}
+}
+
+// checkRuleTags fails on validate and binding tags generated without rules
+func checkRuleTags(t *testing.T, dir string) {
+	t.Helper()
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".go" {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, tag := range []string{`validate:""`, `binding:""`} {
+			if strings.Contains(string(data), tag) {
+				t.Errorf("%s has an empty %s tag", path, tag)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tidyService resolves the dependencies of the generated service, and skips
+// the test when they are unavailable
+func tidyService(t *testing.T, dir string) {
+	t.Helper()
+	if out, err := goCommand(dir, "mod", "tidy"); err != nil {
+		t.Skipf("the dependencies of the generated code are unavailable:\n%s", out)
+	}
+}
+
+func buildService(t *testing.T, dir string) {
+	t.Helper()
+	for _, args := range [][]string{{"build", "./..."}, {"vet", "./..."}} {
+		if out, err := goCommand(dir, args...); err != nil {
+			t.Fatalf("go %s: %v\n%s", args[0], err, out)
+		}
+	}
+}
+
+func goCommand(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	return cmd.CombinedOutput()
+}
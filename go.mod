@@ -3,9 +3,22 @@ module github.com/space-w-alker/go-crud-generator
 go 1.24.1
 
 require (
+	github.com/hashicorp/hcl/v2 v2.23.0
 	github.com/jinzhu/inflection v1.0.0
 	github.com/joho/godotenv v1.5.1
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/samber/lo v1.49.1
+	github.com/zclconf/go-cty v1.13.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require golang.org/x/text v0.23.0 // indirect
+require (
+	github.com/agext/levenshtein v1.2.1 // indirect
+	github.com/apparentlymart/go-textseg/v13 v13.0.0 // indirect
+	github.com/apparentlymart/go-textseg/v15 v15.0.0 // indirect
+	github.com/mitchellh/go-wordwrap v0.0.0-20150314170334-ad45545899c7 // indirect
+	golang.org/x/mod v0.17.0 // indirect
+	golang.org/x/sync v0.12.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
+	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
+)
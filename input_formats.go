@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// schemaNode is a decoded input value that remembers where it was written, so
+// errors found after converting YAML or HCL to JSON can point back at the source
+type schemaNode struct {
+	keys   []string
+	fields map[string]*schemaNode
+	items  []*schemaNode
+	scalar interface{}
+	kind   string // "object", "array" or "scalar"
+	line   int
+	column int
+}
+
+func newObjectNode(line, column int) *schemaNode {
+	return &schemaNode{kind: "object", fields: map[string]*schemaNode{}, line: line, column: column}
+}
+
+func (n *schemaNode) set(key string, value *schemaNode) {
+	if _, exists := n.fields[key]; !exists {
+		n.keys = append(n.keys, key)
+	}
+	n.fields[key] = value
+}
+
+// sourceSpan maps a byte range of the generated JSON to a position in the source
+type sourceSpan struct {
+	start, end   int64
+	line, column int
+}
+
+// sourceMap turns JSON decoding offsets into file:line:column positions
+type sourceMap struct {
+	file  string
+	data  []byte
+	spans []sourceSpan
+}
+
+// encodeSchemaNode writes the node as JSON and records where each value came from
+func encodeSchemaNode(node *schemaNode, buf *bytes.Buffer, spans *[]sourceSpan) error {
+	start := int64(buf.Len())
+	switch node.kind {
+	case "object":
+		buf.WriteByte('{')
+		for i, key := range node.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			k, _ := json.Marshal(key)
+			buf.Write(k)
+			buf.WriteByte(':')
+			if err := encodeSchemaNode(node.fields[key], buf, spans); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case "array":
+		buf.WriteByte('[')
+		for i, item := range node.items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeSchemaNode(item, buf, spans); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		v, err := json.Marshal(node.scalar)
+		if err != nil {
+			return fmt.Errorf("%d:%d: %v", node.line, node.column, err)
+		}
+		buf.Write(v)
+	}
+	*spans = append(*spans, sourceSpan{start: start, end: int64(buf.Len()), line: node.line, column: node.column})
+	return nil
+}
+
+// position finds the source line and column of a JSON decoding offset
+func (m *sourceMap) position(offset int64) (int, int) {
+	if m.spans == nil {
+		// Plain JSON input, count lines up to the offset
+		if offset > int64(len(m.data)) {
+			offset = int64(len(m.data))
+		}
+		before := m.data[:offset]
+		line := bytes.Count(before, []byte("\n")) + 1
+		return line, int(offset) - bytes.LastIndexByte(before, '\n')
+	}
+	// The innermost value that ends at or after the offset is the one being decoded
+	best := -1
+	for i, span := range m.spans {
+		if span.start < offset && offset <= span.end {
+			if best == -1 || span.end-span.start < m.spans[best].end-m.spans[best].start {
+				best = i
+			}
+		}
+	}
+	if best == -1 {
+		return 1, 1
+	}
+	return m.spans[best].line, m.spans[best].column
+}
+
+// wrap prefixes JSON decoding errors with the position they occurred at
+func (m *sourceMap) wrap(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, column := m.position(syntaxErr.Offset)
+		return fmt.Errorf("%s:%d:%d: %v", m.file, line, column, err)
+	case errors.As(err, &typeErr):
+		line, column := m.position(typeErr.Offset)
+		return fmt.Errorf("%s:%d:%d: %v", m.file, line, column, err)
+	default:
+		return fmt.Errorf("%s: %v", m.file, err)
+	}
+}
+
+// toJSONInput converts the input to JSON based on its file extension. JSON files
+// pass through unchanged, YAML and HCL files are converted with a source map.
+func toJSONInput(inputFile string, data []byte) ([]byte, *sourceMap, error) {
+	var root *schemaNode
+	var err error
+	switch strings.ToLower(filepath.Ext(inputFile)) {
+	case ".yaml", ".yml":
+		root, err = parseYAMLNode(inputFile, data)
+	case ".hcl":
+		root, err = parseHCLNode(inputFile, data)
+	default:
+		return data, &sourceMap{file: inputFile, data: data}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	m := &sourceMap{file: inputFile, spans: []sourceSpan{}}
+	if err := encodeSchemaNode(root, &buf, &m.spans); err != nil {
+		return nil, nil, fmt.Errorf("%s:%v", inputFile, err)
+	}
+	m.data = buf.Bytes()
+	return m.data, m, nil
+}
+
+// parseYAMLNode reads a YAML document holding the same structure as the JSON input
+func parseYAMLNode(inputFile string, data []byte) (*schemaNode, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%s: %v", inputFile, err)
+	}
+	if len(document.Content) == 0 {
+		return nil, fmt.Errorf("%s: empty document", inputFile)
+	}
+	node, err := convertYAMLNode(document.Content[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", inputFile, err)
+	}
+	return node, nil
+}
+
+func convertYAMLNode(node *yaml.Node) (*schemaNode, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return convertYAMLNode(node.Alias)
+	case yaml.MappingNode:
+		object := newObjectNode(node.Line, node.Column)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("%d:%d: mapping keys must be scalars", key.Line, key.Column)
+			}
+			converted, err := convertYAMLNode(value)
+			if err != nil {
+				return nil, err
+			}
+			object.set(key.Value, converted)
+		}
+		return object, nil
+	case yaml.SequenceNode:
+		array := &schemaNode{kind: "array", items: []*schemaNode{}, line: node.Line, column: node.Column}
+		for _, item := range node.Content {
+			converted, err := convertYAMLNode(item)
+			if err != nil {
+				return nil, err
+			}
+			array.items = append(array.items, converted)
+		}
+		return array, nil
+	default:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return nil, fmt.Errorf("%d:%d: %v", node.Line, node.Column, err)
+		}
+		return &schemaNode{kind: "scalar", scalar: value, line: node.Line, column: node.Column}, nil
+	}
+}
+
+// hclBlocks describes how HCL blocks map onto the JSON input. Labelled blocks are
+// appended to a collection and their label fills in the name key, unlabelled
+// blocks become a nested object.
+var hclBlocks = map[string]struct {
+	collection string
+	label      string
+}{
+	"entity":             {collection: "", label: "entityName"},
+	"field":              {collection: "fields", label: "fieldName"},
+	"relation":           {collection: "relations", label: "fieldName"},
+	"customEndpoint":     {collection: "customEndpoints", label: "endpointName"},
+	"additionalFeatures": {collection: "additionalFeatures", label: ""},
+}
+
+// parseHCLNode reads an HCL schema made of entity blocks, for example
+//
+//	entity "Course" {
+//	  field "title" {
+//	    fieldType = "string"
+//	  }
+//	  relation "teacher" {
+//	    relationType  = "ManyToOne"
+//	    relatedEntity = "Teacher"
+//	  }
+//	}
+func parseHCLNode(inputFile string, data []byte) (*schemaNode, error) {
+	file, diags := hclsyntax.ParseConfig(data, inputFile, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body := file.Body.(*hclsyntax.Body)
+	if attributes := sortedAttributes(body); len(attributes) > 0 {
+		return nil, hclError(attributes[0].SrcRange, "unexpected attribute %q, the top level only holds entity blocks", attributes[0].Name)
+	}
+
+	root := &schemaNode{kind: "array", items: []*schemaNode{}, line: 1, column: 1}
+	for _, block := range body.Blocks {
+		if block.Type != "entity" {
+			return nil, hclError(block.TypeRange, "unexpected %q block, the top level only holds entity blocks", block.Type)
+		}
+		entity, err := convertHCLBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		root.items = append(root.items, entity)
+	}
+	return root, nil
+}
+
+func convertHCLBlock(block *hclsyntax.Block) (*schemaNode, error) {
+	mapping := hclBlocks[block.Type]
+	object := newObjectNode(block.TypeRange.Start.Line, block.TypeRange.Start.Column)
+
+	if mapping.label != "" {
+		if len(block.Labels) != 1 {
+			return nil, hclError(block.TypeRange, "%s blocks need exactly one label", block.Type)
+		}
+		labelRange := block.LabelRanges[0]
+		object.set(mapping.label, &schemaNode{kind: "scalar", scalar: block.Labels[0], line: labelRange.Start.Line, column: labelRange.Start.Column})
+	} else if len(block.Labels) != 0 {
+		return nil, hclError(block.TypeRange, "%s blocks take no labels", block.Type)
+	}
+
+	for _, attr := range sortedAttributes(block.Body) {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		start := attr.Expr.Range().Start
+		converted, err := convertCtyValue(value, start.Line, start.Column)
+		if err != nil {
+			return nil, hclError(attr.Expr.Range(), "%v", err)
+		}
+		object.set(attr.Name, converted)
+	}
+
+	for _, nested := range block.Body.Blocks {
+		nestedMapping, ok := hclBlocks[nested.Type]
+		if !ok || nested.Type == "entity" {
+			return nil, hclError(nested.TypeRange, "unexpected %q block inside %s", nested.Type, block.Type)
+		}
+		converted, err := convertHCLBlock(nested)
+		if err != nil {
+			return nil, err
+		}
+		if nestedMapping.label == "" {
+			object.set(nestedMapping.collection, converted)
+			continue
+		}
+		collection, exists := object.fields[nestedMapping.collection]
+		if !exists {
+			collection = &schemaNode{kind: "array", items: []*schemaNode{}, line: converted.line, column: converted.column}
+			object.set(nestedMapping.collection, collection)
+		}
+		collection.items = append(collection.items, converted)
+	}
+
+	return object, nil
+}
+
+// sortedAttributes returns the body's attributes in source order, hclsyntax keeps them in a map
+func sortedAttributes(body *hclsyntax.Body) []*hclsyntax.Attribute {
+	attributes := make([]*hclsyntax.Attribute, 0, len(body.Attributes))
+	for _, attr := range body.Attributes {
+		attributes = append(attributes, attr)
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].SrcRange.Start.Byte < attributes[j].SrcRange.Start.Byte
+	})
+	return attributes
+}
+
+func convertCtyValue(value cty.Value, line, column int) (*schemaNode, error) {
+	if value.IsNull() {
+		return &schemaNode{kind: "scalar", scalar: nil, line: line, column: column}, nil
+	}
+	if !value.IsKnown() {
+		return nil, fmt.Errorf("value must be known, variables and functions are not supported")
+	}
+
+	valueType := value.Type()
+	switch {
+	case valueType == cty.String:
+		return &schemaNode{kind: "scalar", scalar: value.AsString(), line: line, column: column}, nil
+	case valueType == cty.Number:
+		return &schemaNode{kind: "scalar", scalar: json.Number(value.AsBigFloat().Text('f', -1)), line: line, column: column}, nil
+	case valueType == cty.Bool:
+		return &schemaNode{kind: "scalar", scalar: value.True(), line: line, column: column}, nil
+	case valueType.IsListType(), valueType.IsTupleType(), valueType.IsSetType():
+		array := &schemaNode{kind: "array", items: []*schemaNode{}, line: line, column: column}
+		for it := value.ElementIterator(); it.Next(); {
+			_, element := it.Element()
+			converted, err := convertCtyValue(element, line, column)
+			if err != nil {
+				return nil, err
+			}
+			array.items = append(array.items, converted)
+		}
+		return array, nil
+	case valueType.IsObjectType(), valueType.IsMapType():
+		object := newObjectNode(line, column)
+		for it := value.ElementIterator(); it.Next(); {
+			key, element := it.Element()
+			converted, err := convertCtyValue(element, line, column)
+			if err != nil {
+				return nil, err
+			}
+			object.set(key.AsString(), converted)
+		}
+		return object, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %s", valueType.FriendlyName())
+	}
+}
+
+func hclError(subject hcl.Range, format string, args ...interface{}) error {
+	return hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf(format, args...),
+		Subject:  &subject,
+	}}
+}
@@ -0,0 +1,150 @@
+package main
+
+//go:generate go run . schema -o entity.schema.json
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/samber/lo"
+)
+
+// fieldTypes lists the fieldType values convertTypeScriptTypeToGo understands
+var fieldTypes = func() []string {
+	types := lo.Keys(goTypes)
+	sort.Strings(types)
+	return types
+}()
+
+// caseInsensitivePattern matches any of values regardless of case, as the
+// generator compares fieldTypes
+func caseInsensitivePattern(values []string) string {
+	alternatives := lo.Map(values, func(value string, _ int) string {
+		var b strings.Builder
+		for _, r := range value {
+			if upper, lower := unicode.ToUpper(r), unicode.ToLower(r); upper != lower {
+				b.WriteString("[" + string(upper) + string(lower) + "]")
+			} else {
+				b.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		return b.String()
+	})
+	return "^(" + strings.Join(alternatives, "|") + ")$"
+}
+
+// schemaConstraints narrows properties whose Go type is looser than the accepted
+// values, keyed by "<Type>.<json name>"
+var schemaConstraints = map[string]map[string]interface{}{
+	// The enum offers completions, the pattern accepts them in any case
+	"Field.fieldType":           {"anyOf": []interface{}{map[string]interface{}{"enum": fieldTypes}, map[string]interface{}{"pattern": caseInsensitivePattern(fieldTypes)}}},
+	"Field.enumConstraint":      {"enum": []string{"check", "native"}},
+	"Relation.relationType":     {"enum": relationTypes},
+	"CustomEndpoint.httpMethod": {"enum": httpMethods},
+	// Booleans are still accepted and mean offset pagination
+	"AdditionalFeatures.pagination":   {"type": []string{"string", "boolean"}, "enum": []interface{}{paginationOffset, paginationCursor, true, false}},
+	"AdditionalFeatures.preloadDepth": {"minimum": 0},
+	"Relation.deleteBehavior":         {"deprecated": true, "description": "Ignored, set cascade instead"},
+}
+
+// schemaRequired lists the properties each definition must set
+var schemaRequired = map[string][]string{
+	"Entity":         {"entityName", "fields"},
+	"Field":          {"fieldName", "fieldType"},
+	"Relation":       {"relationType", "relatedEntity", "fieldName"},
+	"CustomEndpoint": {"endpointName", "httpMethod", "path"},
+}
+
+// schemaClosed lists the definitions that reject unknown properties, so that a
+// misspelled key is reported instead of silently ignored
+var schemaClosed = map[string]bool{
+	"Entity":             true,
+	"Field":              true,
+	"Relation":           true,
+	"AdditionalFeatures": true,
+}
+
+// schemaExtraProperties adds properties that have no input struct field
+var schemaExtraProperties = map[string]map[string]interface{}{
+	// An entity file may point at this schema itself
+	"Entity": {"$schema": map[string]interface{}{"type": "string"}},
+}
+
+// inputJSONSchema describes the entity input format. It is built from the input
+// structs, so new struct fields show up in the schema without further changes.
+func inputJSONSchema() ([]byte, error) {
+	defs := map[string]interface{}{}
+	entity := reflectSchema(reflect.TypeOf(Entity{}), defs)
+
+	schema := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "go-crud-generator entity definitions",
+		"description": "A single entity or an array of entities",
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "array", "items": entity},
+			entity,
+		},
+		"$defs": defs,
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// reflectSchema returns the schema of t, registering struct types under $defs
+func reflectSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return reflectSchema(t.Elem(), defs)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": reflectSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": reflectSchema(t.Elem(), defs)}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	}
+
+	ref := map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	if _, done := defs[t.Name()]; done {
+		return ref
+	}
+	// Register first so recursive types terminate
+	defs[t.Name()] = nil
+
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if !field.IsExported() || name == "-" || name == "" {
+			continue
+		}
+		property := reflectSchema(field.Type, defs)
+		for key, value := range schemaConstraints[t.Name()+"."+name] {
+			property[key] = value
+		}
+		properties[name] = property
+	}
+	for name, property := range schemaExtraProperties[t.Name()] {
+		properties[name] = property
+	}
+
+	def := map[string]interface{}{"type": "object", "properties": properties}
+	if required, ok := schemaRequired[t.Name()]; ok {
+		def["required"] = required
+	}
+	if schemaClosed[t.Name()] {
+		def["additionalProperties"] = false
+	}
+	defs[t.Name()] = def
+	return ref
+}
@@ -5,15 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"go/format"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"unicode"
 
 	"github.com/jinzhu/inflection"
-	"github.com/joho/godotenv"
 	"github.com/samber/lo"
 )
 
@@ -24,10 +27,47 @@ type Field struct {
 	FieldType  string      `json:"fieldType"`
 	FilterBy   bool        `json:"filterBy,omitempty"`
 	Searchable bool        `json:"searchable,omitempty"`
+	Sortable   bool        `json:"sortable,omitempty"`
 	Primary    bool        `json:"primary"`
 	Nullable   bool        `json:"nullable"`
 	Default    interface{} `json:"default"`
 	Unique     bool        `json:"unique"`
+	MinLength  *int        `json:"minLength,omitempty"`
+	MaxLength  *int        `json:"maxLength,omitempty"`
+	Min        *float64    `json:"min,omitempty"`
+	Max        *float64    `json:"max,omitempty"`
+	Pattern    string      `json:"pattern,omitempty"`
+	Email      bool        `json:"email,omitempty"`
+	URL        bool        `json:"url,omitempty"`
+	UUID       bool        `json:"uuid,omitempty"`
+	OneOf      []string    `json:"oneOf,omitempty"`
+	Values     []string    `json:"values,omitempty"`
+	// "check" adds a CHECK constraint for enum values, "native" uses a Postgres enum type
+	EnumConstraint string `json:"enumConstraint,omitempty"`
+}
+
+func (field Field) IsEnum() bool {
+	return strings.EqualFold(field.FieldType, "enum") && len(field.Values) > 0
+}
+
+func (field Field) IsJSON() bool {
+	return strings.EqualFold(field.FieldType, "jsonb")
+}
+
+// AllowedValues lists the values oneOf, or the values of an enum, restrict the field to
+func (field Field) AllowedValues() []string {
+	if len(field.OneOf) == 0 && field.IsEnum() {
+		return field.Values
+	}
+	return field.OneOf
+}
+
+// QueryBindingTag validates the value of the equality filter of enum and oneOf fields
+func (field Field) QueryBindingTag() string {
+	if allowed := field.AllowedValues(); len(allowed) > 0 {
+		return fmt.Sprintf(` binding:"omitempty,oneof=%s"`, strings.Join(allowed, " "))
+	}
+	return ""
 }
 
 type Relation struct {
@@ -38,6 +78,24 @@ type Relation struct {
 	Nullable      bool   `json:"nullable"`
 	Cascade       bool   `json:"cascade"`
 	OneToOneOwner bool   `json:"oneToOneOwner"`
+	// DeleteBehavior is deprecated and ignored, cascade sets what deleting the
+	// related row does. It is only read to warn about it.
+	DeleteBehavior string `json:"deleteBehavior,omitempty"`
+
+	// relatedKey is the primary key of the related entity, set by AssignRelations
+	relatedKey *Field
+	// related is the related entity, set by AssignRelations
+	related *Entity
+	// keyField names a declared field that holds the foreign key, as the key
+	// fields of a junction entity do. For OneToMany it is a field of the
+	// related entity. Set by AssignRelations.
+	keyField string
+}
+
+// HasForeignKeyField reports whether the relation adds an <Field>ID field to
+// the model and DTOs, rather than reusing a declared field
+func (relation Relation) HasForeignKeyField() bool {
+	return ownsForeignKey(relation) && relation.keyField == ""
 }
 
 type CustomEndpoint struct {
@@ -47,13 +105,41 @@ type CustomEndpoint struct {
 	Description  string `json:"description"`
 }
 
+// PaginationMode selects how GetAll pages through an entity. Booleans, from
+// before there was a choice, mean offset pagination.
+type PaginationMode string
+
+const (
+	paginationOffset PaginationMode = "offset"
+	paginationCursor PaginationMode = "cursor"
+)
+
+var paginationModes = []PaginationMode{paginationOffset, paginationCursor}
+
+func (mode *PaginationMode) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*mode = paginationOffset
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("pagination must be \"offset\" or \"cursor\"")
+	}
+	*mode = PaginationMode(name)
+	return nil
+}
+
 type AdditionalFeatures struct {
-	SoftDelete             bool     `json:"softDelete"`
-	Pagination             bool     `json:"pagination"`
-	Sorting                bool     `json:"sorting"`
-	DateFiltering          bool     `json:"dateFiltering"`
-	AuthenticationRequired bool     `json:"authenticationRequired"`
-	CustomValidationRules  []string `json:"customValidationRules"`
+	SoftDelete             bool            `json:"softDelete"`
+	Pagination             PaginationMode  `json:"pagination"`
+	Sorting                bool            `json:"sorting"`
+	DateFiltering          bool            `json:"dateFiltering"`
+	AuthenticationRequired bool            `json:"authenticationRequired"`
+	EndpointAuthentication map[string]bool `json:"endpointAuthentication,omitempty"`
+	CustomValidationRules  []string        `json:"customValidationRules"`
+	// PreloadDepth bounds how many relations deep a preload path goes, 2 when unset
+	PreloadDepth *int `json:"preloadDepth,omitempty"`
 }
 
 type Entity struct {
@@ -64,6 +150,8 @@ type Entity struct {
 	Relations          []Relation         `json:"relations"`
 	AdditionalFeatures AdditionalFeatures `json:"additionalFeatures"`
 	CustomEndpoints    []CustomEndpoint   `json:"customEndpoints"`
+
+	source schemaLocation
 }
 
 // Helper functions for templates
@@ -94,13 +182,21 @@ func (input *Entity) HasPrimaryKey() bool {
 }
 
 func (input *Entity) GetPrimaryKey() Field {
-	for _, field := range input.Fields {
-		if field.Primary {
-			return field
-		}
+	return input.GetPrimaryKeys()[0]
+}
+
+// GetPrimaryKeys lists the primary key fields, more than one for a composite key
+func (input *Entity) GetPrimaryKeys() []Field {
+	keys := lo.Filter(input.Fields, func(field Field, _ int) bool { return field.Primary })
+	if len(keys) == 0 {
+		// Default to ID if no primary key is specified
+		return []Field{{FieldName: "ID", FieldType: "string", Primary: true, Nullable: false}}
 	}
-	// Default to ID if no primary key is specified
-	return Field{FieldName: "ID", FieldType: "string", Primary: true, Nullable: false}
+	return keys
+}
+
+func (input *Entity) HasCompositePrimaryKey() bool {
+	return len(input.GetPrimaryKeys()) > 1
 }
 
 func (input *Entity) GetPrimaryKeyName() string {
@@ -111,26 +207,545 @@ func (input *Entity) GetPrimaryKeyType() string {
 	return convertTypeScriptTypeToGo(input.GetPrimaryKey().FieldType)
 }
 
+// IDType is the Go type identifying one row: the key's type, or for a
+// composite key the <Entity>Key struct of the dto package, qualified by pkg
+func (input *Entity) IDType(pkg string) string {
+	if input.HasCompositePrimaryKey() {
+		return pkg + input.EntityName + "Key"
+	}
+	return input.GetPrimaryKeyType()
+}
+
+// KeyCondition is the WHERE condition matching one row by its primary key
+func (input *Entity) KeyCondition() string {
+	return strings.Join(lo.Map(input.GetPrimaryKeys(), func(field Field, _ int) string {
+		return lo.SnakeCase(field.FieldName) + " = ?"
+	}), " AND ")
+}
+
+// KeyArgs are the arguments of KeyCondition taken from the IDType variable id
+func (input *Entity) KeyArgs(id string) string {
+	if !input.HasCompositePrimaryKey() {
+		return id
+	}
+	return input.ModelKeyArgs(id)
+}
+
+// ModelKeyArgs are the arguments of KeyCondition taken from a model or key struct
+func (input *Entity) ModelKeyArgs(model string) string {
+	return strings.Join(lo.Map(input.GetPrimaryKeys(), func(field Field, _ int) string {
+		return model + "." + toGoFieldName(field.FieldName)
+	}), ", ")
+}
+
+// KeyParams names the path parameters of the primary key, "id" unless composite
+func (input *Entity) KeyParams() []string {
+	if !input.HasCompositePrimaryKey() {
+		return []string{"id"}
+	}
+	return lo.Map(input.GetPrimaryKeys(), func(field Field, _ int) string { return field.FieldName })
+}
+
+// RoutePath is the gin path of one row, e.g. /:id or /:studentId/:courseId
+func (input *Entity) RoutePath() string {
+	return strings.Join(lo.Map(input.KeyParams(), func(param string, _ int) string { return "/:" + param }), "")
+}
+
+// SwaggerPath is RoutePath in swagger notation, e.g. /{id}
+func (input *Entity) SwaggerPath() string {
+	return strings.Join(lo.Map(input.KeyParams(), func(param string, _ int) string { return "/{" + param + "}" }), "")
+}
+
+// PrimaryKeyKind is one of keyUUID, keyULID, keyInt and keyBigint
+func (input *Entity) PrimaryKeyKind() string {
+	return primaryKeyKind(input.GetPrimaryKey())
+}
+
+// HasIntegerPrimaryKey reports whether the database assigns the primary key.
+// Composite keys are always given by the client.
+func (input *Entity) HasIntegerPrimaryKey() bool {
+	kind := input.PrimaryKeyKind()
+	return !input.HasCompositePrimaryKey() && (kind == keyInt || kind == keyBigint)
+}
+
+// GeneratesPrimaryKey reports whether the model sets a UUID or ULID key before
+// inserting a row
+func (input *Entity) GeneratesPrimaryKey() bool {
+	return !input.HasCompositePrimaryKey() && !input.HasIntegerPrimaryKey()
+}
+
+func (input *Entity) HasEnumFields() bool {
+	return lo.SomeBy(input.Fields, Field.IsEnum)
+}
+
+func (input *Entity) HasJSONFields() bool {
+	return lo.SomeBy(input.Fields, Field.IsJSON)
+}
+
+// HasToManyRelations reports whether a OneToMany or ManyToMany relation lists
+// related rows
+func (input *Entity) HasToManyRelations() bool {
+	return lo.SomeBy(input.Relations, func(relation Relation) bool {
+		return relation.RelationType == "OneToMany" || relation.RelationType == "ManyToMany"
+	})
+}
+
+// HasTimeFields reports whether a field, virtual ones included, is a time.Time
+func (input *Entity) HasTimeFields() bool {
+	return lo.SomeBy(input.Fields, func(field Field) bool {
+		return convertTypeScriptTypeToGo(field.FieldType) == "time.Time"
+	})
+}
+
+// HasDateFilters reports whether the entity filters on a date field with
+// <field>After and <field>Before
+func (input *Entity) HasDateFilters() bool {
+	return lo.SomeBy(input.Fields, func(field Field) bool {
+		return field.FilterBy && field.FieldType == "date" && !field.Virtual
+	})
+}
+
+// HasTimeFilters reports whether an operator filter of the entity binds a
+// dto.FilterTime
+func (input *Entity) HasTimeFilters() bool {
+	return lo.SomeBy(input.FieldOperators(), func(op FieldOperator) bool {
+		return op.BindsTime()
+	})
+}
+
+// HasValidators reports whether the entity registers validators of its own:
+// field patterns or custom validation rules
+func (input *Entity) HasValidators() bool {
+	return len(input.AdditionalFeatures.CustomValidationRules) > 0 || lo.SomeBy(input.Fields, func(field Field) bool {
+		return field.Pattern != ""
+	})
+}
+
+// ModelImports lists the packages the generated model uses
+func (input *Entity) ModelImports() []string {
+	var imports []string
+	if input.GeneratesPrimaryKey() || input.AdditionalFeatures.SoftDelete {
+		imports = append(imports, "gorm.io/gorm")
+	}
+	if input.HasJSONFields() {
+		imports = append(imports, "gorm.io/datatypes")
+	}
+	if input.GeneratesPrimaryKey() {
+		switch input.PrimaryKeyKind() {
+		case keyUUID:
+			imports = append(imports, "github.com/google/uuid")
+		case keyULID:
+			imports = append(imports, "github.com/oklog/ulid/v2")
+		}
+	}
+	if lo.SomeBy(input.Fields, func(field Field) bool {
+		return !field.Virtual && convertTypeScriptTypeToGo(field.FieldType) == "time.Time"
+	}) {
+		imports = append(imports, "time")
+	}
+	return imports
+}
+
+// Endpoints lists the controller handler names generated for the entity,
+// custom endpoints included
+func (input *Entity) Endpoints() []string {
+	endpoints := []string{"Create", "BulkCreate", "GetAll", "GetByID", "Update", "BulkUpdate", "Delete"}
+	if input.AdditionalFeatures.SoftDelete {
+		endpoints = append(endpoints, "Restore", "Purge")
+	}
+	for _, endpoint := range input.CustomEndpoints {
+		endpoints = append(endpoints, endpoint.EndpointName)
+	}
+	return endpoints
+}
+
+// RequiresAuth reports whether the named handler is registered behind AuthMiddleware.
+// An entry in endpointAuthentication overrides the entity wide authenticationRequired flag.
+func (input *Entity) RequiresAuth(endpoint string) bool {
+	if required, ok := input.AdditionalFeatures.EndpointAuthentication[endpoint]; ok {
+		return required
+	}
+	return input.AdditionalFeatures.AuthenticationRequired
+}
+
+func (input *Entity) HasAuthenticatedEndpoints() bool {
+	return lo.SomeBy(input.Endpoints(), input.RequiresAuth)
+}
+
+// UsesCursorPagination reports whether GetAll pages by cursor instead of offset
+func (input *Entity) UsesCursorPagination() bool {
+	return input.AdditionalFeatures.Pagination == paginationCursor
+}
+
+// SortKey is a key GetAll accepts in sortBy, with the column it sorts on
+type SortKey struct {
+	Key    string
+	Column string
+}
+
+// SortKeys lists the sortBy keys of the entity: the timestamps, then every
+// sortable field. It is empty unless sorting is on.
+func (input *Entity) SortKeys() []SortKey {
+	if !input.AdditionalFeatures.Sorting {
+		return nil
+	}
+	table := input.GetTableName()
+	keys := []SortKey{{"createdAt", table + ".created_at"}, {"updatedAt", table + ".updated_at"}}
+	for _, field := range input.Fields {
+		if field.Sortable && !field.Virtual {
+			keys = append(keys, SortKey{field.FieldName, table + "." + lo.SnakeCase(field.FieldName)})
+		}
+	}
+	return lo.UniqBy(keys, func(key SortKey) string { return key.Key })
+}
+
+// defaultPreloadDepth bounds the preload paths of entities without a preloadDepth
+const defaultPreloadDepth = 2
+
+// PreloadPath is a relation path clients can preload, such as author.posts
+type PreloadPath struct {
+	Path        string
+	Association string
+	// Filters are the fields of the last related entity its rows can be filtered by
+	Filters []Filter
+}
+
+// Filter is a column clients can filter on. Kind names the generated
+// FilterKind its values are parsed as.
+type Filter struct {
+	Key    string
+	Column string
+	Kind   string
+}
+
+// PreloadPaths lists every relation path up to the preload depth, following
+// relations back and forth as deep as the depth allows
+func (input *Entity) PreloadPaths() []PreloadPath {
+	depth := defaultPreloadDepth
+	if input.AdditionalFeatures.PreloadDepth != nil {
+		depth = *input.AdditionalFeatures.PreloadDepth
+	}
+
+	var paths []PreloadPath
+	var walk func(entity *Entity, path, association []string)
+	walk = func(entity *Entity, path, association []string) {
+		if len(path) == depth {
+			return
+		}
+		for _, relation := range entity.Relations {
+			if relation.related == nil {
+				continue
+			}
+			relationPath := append(path[:len(path):len(path)], relation.FieldName)
+			relationAssociation := append(association[:len(association):len(association)], toGoFieldName(relation.FieldName))
+			paths = append(paths, PreloadPath{
+				Path:        strings.Join(relationPath, "."),
+				Association: strings.Join(relationAssociation, "."),
+				Filters:     relation.related.Filters(),
+			})
+			walk(relation.related, relationPath, relationAssociation)
+		}
+	}
+	walk(input, nil, nil)
+	return paths
+}
+
+// Filters lists the filterBy fields of the entity that have a filter kind
+func (input *Entity) Filters() []Filter {
+	var filters []Filter
+	for _, field := range input.Fields {
+		kind := filterKind(field)
+		if !field.FilterBy || field.Virtual || kind == "" {
+			continue
+		}
+		filters = append(filters, Filter{Key: field.FieldName, Column: input.GetTableName() + "." + lo.SnakeCase(field.FieldName), Kind: kind})
+	}
+	return filters
+}
+
+// FieldOperator is a query parameter filtering a filterBy field with an
+// operator, as rating[gte]=3 does
+type FieldOperator struct {
+	Field    Field
+	Operator string
+	// List operators take a comma separated list of values
+	List bool
+}
+
+// GoName names the DTO field of the operator, such as RatingGte
+func (op FieldOperator) GoName() string {
+	return toGoFieldName(op.Field.FieldName) + toGoFieldName(op.Operator)
+}
+
+// Param is the query parameter of the operator, such as rating[gte]
+func (op FieldOperator) Param() string {
+	return op.Field.FieldName + "[" + op.Operator + "]"
+}
+
+// Constant names the generated Operator constant, such as OpGte
+func (op FieldOperator) Constant() string {
+	return "Op" + toGoFieldName(op.Operator)
+}
+
+// BindsTime reports whether the operator compares a date, which binds to a
+// dto.FilterTime so dates are accepted as well as timestamps
+func (op FieldOperator) BindsTime() bool {
+	return op.Operator != "isNull" && convertTypeScriptTypeToGo(op.Field.FieldType) == "time.Time"
+}
+
+// GoType is the type the DTO field binds the operator's value to
+func (op FieldOperator) GoType(entityName string) string {
+	switch {
+	case op.Operator == "isNull":
+		return "*bool"
+	case op.BindsTime():
+		return "*FilterTime"
+	case op.List:
+		return "[]" + goFieldType(entityName, op.Field, "models.")
+	default:
+		return "*" + goFieldType(entityName, op.Field, "models.")
+	}
+}
+
+// BindingTag validates the values of enum and oneOf fields
+func (op FieldOperator) BindingTag() string {
+	allowed := op.Field.AllowedValues()
+	if len(allowed) == 0 || op.Operator == "isNull" || op.Operator == "contains" || op.Operator == "startsWith" {
+		return ""
+	}
+	if op.List {
+		return fmt.Sprintf(` binding:"omitempty,dive,oneof=%s"`, strings.Join(allowed, " "))
+	}
+	return fmt.Sprintf(` binding:"omitempty,oneof=%s"`, strings.Join(allowed, " "))
+}
+
+// fieldOperators lists the operators that make sense for the type of a
+// field. Equality is left to the <Entity>Query struct conditions.
+func fieldOperators(field Field) []string {
+	var operators []string
+	switch {
+	case field.IsEnum(), len(field.OneOf) > 0, lo.Contains([]string{"uuid", "ulid"}, strings.ToLower(field.FieldType)):
+		operators = []string{"ne", "in", "notIn"}
+	default:
+		switch convertTypeScriptTypeToGo(field.FieldType) {
+		case "string":
+			operators = []string{"ne", "in", "notIn", "contains", "startsWith"}
+		case "int", "int64", "uint", "float64":
+			operators = []string{"ne", "gt", "gte", "lt", "lte", "in", "notIn"}
+		case "time.Time":
+			operators = []string{"gt", "gte", "lt", "lte"}
+		}
+	}
+	if field.Nullable && !field.IsJSON() {
+		operators = append(operators, "isNull")
+	}
+	return operators
+}
+
+// FieldOperators lists the operator query parameters of the filterBy fields
+func (input *Entity) FieldOperators() []FieldOperator {
+	var ops []FieldOperator
+	for _, field := range input.Fields {
+		if !field.FilterBy || field.Virtual {
+			continue
+		}
+		for _, operator := range fieldOperators(field) {
+			ops = append(ops, FieldOperator{Field: field, Operator: operator, List: operator == "in" || operator == "notIn"})
+		}
+	}
+	return ops
+}
+
+// RelatedFilter matches a field of the entity a to-one relation points to, as
+// class.name=X does
+type RelatedFilter struct {
+	Param  string
+	GoName string
+	GoType string
+	Column string
+}
+
+// JoinFilter groups the filters on the entity of one to-one relation. Its
+// table is joined under the relation's name when any of them is set.
+type JoinFilter struct {
+	Join    string
+	Filters []RelatedFilter
+}
+
+// MembershipFilter keeps the rows a to-many relation links to a given row,
+// as sessionClassID=Y does for the users of a session class
+type MembershipFilter struct {
+	Param  string
+	GoName string
+	GoType string
+	// Exists is the subquery finding the link, with the given key as its argument
+	Exists string
+}
+
+// JoinFilters lists the filters on the filterBy fields of the entities that
+// to-one relations point to
+func (input *Entity) JoinFilters() []JoinFilter {
+	taken := input.queryFieldNames()
+	var joins []JoinFilter
+	for _, relation := range input.Relations {
+		related := relation.related
+		if !ownsForeignKey(relation) || related == nil || related.HasCompositePrimaryKey() {
+			continue
+		}
+		alias := lo.SnakeCase(relation.FieldName)
+		join := JoinFilter{Join: fmt.Sprintf(`JOIN %s %s ON %s.%s = %s.%s`,
+			quoteIdent(related.GetTableName()), quoteIdent(alias),
+			quoteIdent(alias), quoteIdent(lo.SnakeCase(related.GetPrimaryKeyName())),
+			quoteIdent(input.GetTableName()), quoteIdent(foreignKeyColumn(relation.FieldName)))}
+		if related.AdditionalFeatures.SoftDelete {
+			join.Join += fmt.Sprintf(" AND %s.%s IS NULL", quoteIdent(alias), quoteIdent("deleted_at"))
+		}
+		for _, field := range related.Fields {
+			goName := toGoFieldName(relation.FieldName) + toGoFieldName(field.FieldName)
+			if !field.FilterBy || field.Virtual || field.IsJSON() || strings.EqualFold(field.FieldType, "date") || taken[goName] {
+				continue
+			}
+			join.Filters = append(join.Filters, RelatedFilter{
+				Param:  relation.FieldName + "." + field.FieldName,
+				GoName: goName,
+				GoType: goFieldType(related.EntityName, field, "models."),
+				Column: alias + "." + lo.SnakeCase(field.FieldName),
+			})
+		}
+		if len(join.Filters) > 0 {
+			joins = append(joins, join)
+		}
+	}
+	return joins
+}
+
+// MembershipFilters lists the filters keeping the rows linked to a given row
+// of a OneToMany or ManyToMany relation
+func (input *Entity) MembershipFilters() []MembershipFilter {
+	taken := input.queryFieldNames()
+	table := quoteIdent(input.GetTableName())
+	key := quoteIdent(lo.SnakeCase(input.GetPrimaryKeyName()))
+	var filters []MembershipFilter
+	for _, relation := range input.Relations {
+		related := relation.related
+		if related == nil || related.HasCompositePrimaryKey() || input.HasCompositePrimaryKey() {
+			continue
+		}
+		param := inflection.Singular(relation.FieldName) + "ID"
+		if taken[toGoFieldName(param)] {
+			continue
+		}
+
+		var exists string
+		switch relation.RelationType {
+		case "OneToMany":
+			child := quoteIdent(related.GetTableName())
+			column := foreignKeyColumn(lo.CamelCase(lo.CoalesceOrEmpty(relation.ForeignKey, input.EntityName)))
+			exists = fmt.Sprintf("SELECT 1 FROM %s WHERE %s.%s = %s.%s AND %s.%s = ?",
+				child, child, quoteIdent(column), table, key, child, quoteIdent(lo.SnakeCase(related.GetPrimaryKeyName())))
+			if related.AdditionalFeatures.SoftDelete {
+				exists += fmt.Sprintf(" AND %s.%s IS NULL", child, quoteIdent("deleted_at"))
+			}
+		case "ManyToMany":
+			// The columns of the join table, as joinTable names them
+			joinTable := quoteIdent(joinTableName(input.EntityName, relation))
+			ownColumn := lo.SnakeCase(input.EntityName + toGoFieldName(input.GetPrimaryKeyName()))
+			relatedColumn := lo.SnakeCase(related.EntityName + toGoFieldName(related.GetPrimaryKeyName()))
+			if input.EntityName == related.EntityName {
+				relatedColumn = lo.SnakeCase(inflection.Singular(toGoFieldName(relation.FieldName)) + toGoFieldName(related.GetPrimaryKeyName()))
+			}
+			exists = fmt.Sprintf("SELECT 1 FROM %s WHERE %s.%s = %s.%s AND %s.%s = ?",
+				joinTable, joinTable, quoteIdent(ownColumn), table, key, joinTable, quoteIdent(relatedColumn))
+		default:
+			continue
+		}
+		filters = append(filters, MembershipFilter{Param: param, GoName: toGoFieldName(param), GoType: relatedIDType(relation), Exists: exists})
+	}
+	return filters
+}
+
+// HasFilters reports whether the entity has an <Entity>Filters DTO
+func (input *Entity) HasFilters() bool {
+	return len(input.FieldOperators()) > 0 || len(input.JoinFilters()) > 0 || len(input.MembershipFilters()) > 0
+}
+
+// queryFieldNames lists the Go names of the other fields of the full query
+// DTO, which the relation filters must not shadow
+func (input *Entity) queryFieldNames() map[string]bool {
+	taken := lo.SliceToMap([]string{"After", "Before", "Q", "Page", "Size", "SortBy", "SortOrder", "Cursor", "WithCount", "IncludeDeleted", "OnlyDeleted", "Preload"},
+		func(name string) (string, bool) { return name, true })
+	for _, field := range input.Fields {
+		taken[toGoFieldName(field.FieldName)] = true
+		taken[toGoFieldName(field.FieldName)+"After"] = true
+		taken[toGoFieldName(field.FieldName)+"Before"] = true
+	}
+	for _, relation := range input.Relations {
+		taken[toGoFieldName(relation.FieldName)+"ID"] = true
+	}
+	for _, op := range input.FieldOperators() {
+		taken[op.GoName()] = true
+	}
+	return taken
+}
+
+// filterKind maps a field to the FilterKind its filter values are parsed as,
+// or "" for fields that can't be filtered on
+func filterKind(field Field) string {
+	switch convertTypeScriptTypeToGo(field.FieldType) {
+	case "string":
+		return "FilterString"
+	case "int", "int64":
+		return "FilterInt"
+	case "uint":
+		return "FilterUint"
+	case "float64":
+		return "FilterFloat"
+	case "bool":
+		return "FilterBool"
+	case "time.Time":
+		return "FilterTime"
+	default:
+		return ""
+	}
+}
+
+// RouteGroupFor returns the router group variable the handler is registered on
+func (input *Entity) RouteGroupFor(endpoint string) string {
+	if input.RequiresAuth(endpoint) {
+		return "authenticated"
+	}
+	return input.EntityName
+}
+
+// goTypes maps each fieldType to the Go type of its model field
+var goTypes = map[string]string{
+	"string":   "string",
+	"enum":     "string",
+	"json":     "string",
+	"uuid":     "string",
+	"ulid":     "string",
+	"number":   "int",
+	"int":      "int",
+	"integer":  "int",
+	"bigint":   "int64",
+	"uint":     "uint",
+	"uint64":   "uint",
+	"float":    "float64",
+	"double":   "float64",
+	"decimal":  "float64",
+	"boolean":  "bool",
+	"bool":     "bool",
+	"date":     "time.Time",
+	"datetime": "time.Time",
+	"jsonb":    "datatypes.JSON",
+}
+
 // Helper function to convert TypeScript types to Go types
 func convertTypeScriptTypeToGo(tsType string) string {
-	switch strings.ToLower(tsType) {
-	case "string", "enum", "json":
-		return "string"
-	case "number", "int", "integer":
-		return "int"
-	case "float", "double", "decimal":
-		return "float64"
-	case "boolean", "bool":
-		return "bool"
-	case "date", "datetime":
-		return "time.Time"
-	case "uuid":
-		return "string"
-	case "uint", "uint64":
-		return "uint"
-	default:
-		return "interface{}"
+	if goType, ok := goTypes[strings.ToLower(tsType)]; ok {
+		return goType
 	}
+	return "interface{}"
 }
 
 // Helper to convert field name to a Go-style name
@@ -160,6 +775,152 @@ func toSnakeCase(s string) string {
 	return result.String()
 }
 
+// Primary key kinds. UUID and ULID keys are strings the model generates before
+// inserting a row, integer keys are assigned by the database.
+const (
+	keyUUID   = "uuid"
+	keyULID   = "ulid"
+	keyInt    = "int"
+	keyBigint = "bigint"
+)
+
+// primaryKeyFieldTypes lists the fieldType values a primary key may have.
+// "string" keys are UUIDs, as they have always been.
+var primaryKeyFieldTypes = []string{"uuid", "string", "ulid", "number", "int", "integer", "uint", "uint64", "bigint"}
+
+// primaryKeyKind classifies the fieldType of a primary key
+func primaryKeyKind(field Field) string {
+	switch strings.ToLower(field.FieldType) {
+	case "ulid":
+		return keyULID
+	case "number", "int", "integer", "uint", "uint64":
+		return keyInt
+	case "bigint":
+		return keyBigint
+	default:
+		return keyUUID
+	}
+}
+
+// relatedIDType is the Go type of the foreign keys pointing to the related entity
+func relatedIDType(relation Relation) string {
+	if relation.relatedKey == nil {
+		return "string"
+	}
+	return convertTypeScriptTypeToGo(relation.relatedKey.FieldType)
+}
+
+// relatedKeyColumn is the primary key column of the related entity
+func relatedKeyColumn(relation Relation) string {
+	if relation.relatedKey == nil {
+		return "id"
+	}
+	return lo.SnakeCase(relation.relatedKey.FieldName)
+}
+
+// enumTypeName names the Go string type generated for an enum field
+func enumTypeName(entityName string, field Field) string {
+	return entityName + lo.PascalCase(field.FieldName)
+}
+
+func enumConstName(entityName string, field Field, value string) string {
+	return enumTypeName(entityName, field) + lo.PascalCase(value)
+}
+
+// enumSQLType names the native Postgres enum type of a field
+func enumSQLType(tableName string, field Field) string {
+	return tableName + "_" + lo.SnakeCase(field.FieldName)
+}
+
+// goFieldType is the Go type of a field, enum fields use their generated type,
+// qualified with the models package outside of it
+func goFieldType(entityName string, field Field, qualifier string) string {
+	if field.IsEnum() {
+		return qualifier + enumTypeName(entityName, field)
+	}
+	return convertTypeScriptTypeToGo(field.FieldType)
+}
+
+// ruleTag renders validation rules as a struct tag with a leading space, or
+// nothing when there are no rules
+func ruleTag(key string, rules []string) string {
+	if len(rules) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" %s:\"%s\"", key, strings.Join(rules, ","))
+}
+
+// joinTableName names the join table of a ManyToMany relation. Without an
+// explicit foreignKey both sides of the relation agree on the lower cased
+// entity names in alphabetical order, e.g. course_student.
+func joinTableName(entityName string, relation Relation) string {
+	if relation.ForeignKey != "" {
+		return relation.ForeignKey
+	}
+	names := []string{strings.ToLower(entityName), strings.ToLower(relation.RelatedEntity)}
+	sort.Strings(names)
+	return strings.Join(names, "_")
+}
+
+// sqlStringList renders values as a comma separated list of SQL string literals
+func sqlStringList(values []string) string {
+	return strings.Join(lo.Map(values, func(value string, _ int) string {
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}), ", ")
+}
+
+// patternTag names the validator registered for a field's pattern constraint
+func patternTag(entityName string, field Field) string {
+	return lo.CamelCase(entityName+" "+field.FieldName) + "Pattern"
+}
+
+// validationRules builds the go-playground/validator rules for a field. Constraints on
+// optional fields are prefixed with omitempty so a missing value still passes.
+func validationRules(entityName string, field Field, required bool) []string {
+	var constraints []string
+	if field.MinLength != nil {
+		constraints = append(constraints, fmt.Sprintf("min=%d", *field.MinLength))
+	}
+	if field.MaxLength != nil {
+		constraints = append(constraints, fmt.Sprintf("max=%d", *field.MaxLength))
+	}
+	if field.Min != nil {
+		constraints = append(constraints, "min="+strconv.FormatFloat(*field.Min, 'f', -1, 64))
+	}
+	if field.Max != nil {
+		constraints = append(constraints, "max="+strconv.FormatFloat(*field.Max, 'f', -1, 64))
+	}
+	if field.Email {
+		constraints = append(constraints, "email")
+	}
+	if field.URL {
+		constraints = append(constraints, "url")
+	}
+	if field.UUID {
+		constraints = append(constraints, "uuid")
+	}
+	if allowed := field.AllowedValues(); len(allowed) > 0 {
+		constraints = append(constraints, "oneof="+strings.Join(allowed, " "))
+	}
+	if field.Pattern != "" {
+		constraints = append(constraints, patternTag(entityName, field))
+	}
+
+	if required {
+		return append([]string{"required"}, constraints...)
+	}
+	if len(constraints) > 0 {
+		return append([]string{"omitempty"}, constraints...)
+	}
+	return nil
+}
+
+// requiredOnCreate reports whether a new row must set the field. Keys are
+// generated, except for the columns of a composite key.
+func requiredOnCreate(entity *Entity, field Field) bool {
+	return !field.Nullable && (!field.Primary || entity.HasCompositePrimaryKey())
+}
+
 // Template helpers
 var templateFuncs = template.FuncMap{
 	"toGoFieldName":             toGoFieldName,
@@ -170,14 +931,35 @@ var templateFuncs = template.FuncMap{
 	"pascalCase":                lo.PascalCase,
 	"camelCase":                 lo.CamelCase,
 	"convertTypeScriptTypeToGo": convertTypeScriptTypeToGo,
-	"formatGormTags": func(field Field, tableName string) string {
+	"goFieldType":               goFieldType,
+	"enumTypeName":              enumTypeName,
+	"enumConstName":             enumConstName,
+	"enumSQLType":               enumSQLType,
+	"sqlStringList":             sqlStringList,
+	"patternTag":                patternTag,
+	"formatGormTags": func(field Field, entity *Entity) string {
 		var tags []string
+		tableName := entity.GetTableName()
 		column := lo.SnakeCase(field.FieldName)
 
 		tags = append(tags, fmt.Sprintf("column:%s", column))
 
 		if field.Primary {
-			tags = append(tags, "primaryKey", "type:char(36)", "not null")
+			tags = append(tags, "primaryKey")
+			switch primaryKeyKind(field) {
+			case keyUUID:
+				tags = append(tags, "type:char(36)")
+			case keyULID:
+				tags = append(tags, "type:char(26)")
+			default:
+				// gorm auto increments integer keys unless told otherwise
+				if entity.HasCompositePrimaryKey() {
+					tags = append(tags, "autoIncrement:false")
+				} else {
+					tags = append(tags, "autoIncrement")
+				}
+			}
+			tags = append(tags, "not null")
 		}
 
 		if !field.Nullable && !field.Primary {
@@ -192,37 +974,49 @@ var templateFuncs = template.FuncMap{
 			tags = append(tags, fmt.Sprintf("default:%v", field.Default))
 		}
 
-		// Auto-increment for primary keys that are integers
-		if field.Primary && (strings.Contains(field.FieldType, "int") || strings.Contains(field.FieldType, "uint")) {
-			tags = append(tags, "autoIncrement")
+		if field.IsEnum() {
+			switch field.EnumConstraint {
+			case "check":
+				tags = append(tags, fmt.Sprintf("check:chk_%s_%s,%s IN (%s)", tableName, column, column, sqlStringList(field.Values)))
+			case "native":
+				tags = append(tags, "type:"+enumSQLType(tableName, field))
+			}
 		}
 
 		return fmt.Sprintf("gorm:\"%s\"", strings.Join(tags, ";"))
 	},
-	"formatValidationTags": func(field Field) string {
-		var tags []string
-
-		if !field.Nullable && !field.Primary {
-			tags = append(tags, "required")
-		}
-
-		return fmt.Sprintf("validate:\"%s\"", strings.Join(tags, ","))
+	"formatValidationTags": func(entity *Entity, field Field) string {
+		return ruleTag("validate", validationRules(entity.EntityName, field, requiredOnCreate(entity, field)))
 	},
-	"formatValidationRules": func(field Field) string {
-		var rules []string
-
-		if !field.Nullable && !field.Primary {
-			rules = append(rules, "required")
+	"formatBindingTags": func(entity *Entity, field Field) string {
+		return ruleTag("binding", validationRules(entity.EntityName, field, requiredOnCreate(entity, field)))
+	},
+	"formatUpdateBindingTags": func(entityName string, field Field) string {
+		return ruleTag("binding", validationRules(entityName, field, false))
+	},
+	"formatSwaggerTags": func(field Field) string {
+		if field.IsJSON() {
+			return " swaggertype:\"object\""
 		}
-
-		return strings.Join(rules, ",")
+		if !field.IsEnum() {
+			return ""
+		}
+		return fmt.Sprintf(" enums:\"%s\"", strings.Join(field.Values, ","))
 	},
 	"formatRelation": func(entityName string, relation Relation) string {
 		switch relation.RelationType {
 		case "OneToOne", "ManyToOne":
+			if relation.keyField != "" {
+				return fmt.Sprintf("%s *%s `gorm:\"foreignKey:%s\"`",
+					toGoFieldName(relation.FieldName),
+					relation.RelatedEntity,
+					relation.keyField)
+			}
+
 			// Add both the foreign key field and the relationship field with a newline
-			foreignKeyField := fmt.Sprintf("%sID *string `gorm:\"column:%s_id\"`",
+			foreignKeyField := fmt.Sprintf("%sID *%s `gorm:\"column:%s_id\"`",
 				toGoFieldName(relation.FieldName),
+				relatedIDType(relation),
 				toSnakeCase(relation.FieldName))
 
 			if !relation.OneToOneOwner {
@@ -240,10 +1034,10 @@ var templateFuncs = template.FuncMap{
 			return foreignKeyField + "\n\t" + relationField
 
 		case "OneToMany":
-			return fmt.Sprintf("%s []%s `gorm:\"foreignKey:%sID%s\"`",
+			return fmt.Sprintf("%s []%s `gorm:\"foreignKey:%s%s\"`",
 				toGoFieldName(relation.FieldName),
 				relation.RelatedEntity,
-				lo.CoalesceOrEmpty(lo.PascalCase(relation.ForeignKey), lo.PascalCase(entityName)),
+				lo.CoalesceOrEmpty(relation.keyField, lo.CoalesceOrEmpty(lo.PascalCase(relation.ForeignKey), lo.PascalCase(entityName))+"ID"),
 				func() string {
 					if relation.Cascade {
 						return ";constraint:OnDelete:CASCADE,OnUpdate:CASCADE"
@@ -252,11 +1046,10 @@ var templateFuncs = template.FuncMap{
 				}())
 
 		case "ManyToMany":
-			foreignTable := fmt.Sprintf("%s_%s", strings.ToLower(entityName), strings.ToLower(relation.RelatedEntity))
 			return fmt.Sprintf("%s []%s `gorm:\"many2many:%s\"`",
 				toGoFieldName(relation.FieldName),
 				relation.RelatedEntity,
-				lo.CoalesceOrEmpty(relation.ForeignKey, foreignTable)+";constraint:OnDelete:CASCADE,OnUpdate:CASCADE")
+				joinTableName(entityName, relation)+";constraint:OnDelete:CASCADE,OnUpdate:CASCADE")
 
 		default:
 			return ""
@@ -265,14 +1058,15 @@ var templateFuncs = template.FuncMap{
 	"formatRelationDTO": func(relation Relation) string {
 		switch relation.RelationType {
 		case "OneToOne", "ManyToOne":
-			foreignKeyField := fmt.Sprintf("%sID *string `json:\"%sID,omitempty\"`",
+			foreignKeyField := fmt.Sprintf("%sID *%s `json:\"%sID,omitempty\"`",
 				toGoFieldName(relation.FieldName),
+				relatedIDType(relation),
 				relation.FieldName)
 			relationField := fmt.Sprintf("%s *%sResponse `json:\"%s,omitempty\"`",
 				toGoFieldName(relation.FieldName),
 				relation.RelatedEntity,
 				relation.FieldName)
-			if relation.OneToOneOwner {
+			if !relation.HasForeignKeyField() {
 				return relationField
 			}
 			return foreignKeyField + "\n\t" + relationField
@@ -285,9 +1079,8 @@ var templateFuncs = template.FuncMap{
 			return ""
 		}
 	},
-	"relatedIDType": func(relation Relation) string {
-		return "string"
-	},
+	"relatedIDType":    relatedIDType,
+	"relatedKeyColumn": relatedKeyColumn,
 	"getZeroValue": func(typeName string) string {
 		switch strings.ToLower(typeName) {
 		case "string":
@@ -305,64 +1098,110 @@ var templateFuncs = template.FuncMap{
 }
 
 func main() {
-	// Read the input JSON from a file or command-line argument
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run generator.go <input.json> [output_directory]")
-		return
-	}
+	os.Exit(run(os.Args[1:]))
+}
 
-	// Load environment variables from .env file
-	if err := godotenv.Load(); err != nil {
-		// .env file is optional, so we don't fail if it doesn't exist
-		fmt.Println("Warning: .env file not found, using default values")
-	}
+// generator carries the settings shared by every file of one generation run
+type generator struct {
+	outputDir  string
+	moduleName string
+	// templateDir holds templates that replace the embedded ones, if set
+	templateDir string
+	// force overwrites user owned files that already exist and generated
+	// files edited by hand
+	force bool
+	// dryRun renders every file without writing anything
+	dryRun  bool
+	verbose bool
+	quiet   bool
+
+	// counts tallies the files of the run by status
+	counts map[fileStatus]int
+	// previous is the manifest of the last run, next the one this run writes
+	previous, next *manifest
+	// prune deletes generated files of entities removed from the schema,
+	// pruneUserOwned their user owned files as well
+	prune          bool
+	pruneUserOwned bool
+	// workers bounds how many files are rendered at once
+	workers int
+	// templates are parsed once per run and shared by all workers
+	templates map[string]*template.Template
+}
 
-	inputFile := os.Args[1]
-	outputDir := "output"
-	if len(os.Args) > 2 {
-		outputDir = os.Args[2]
+// run generates the service code for the validated entities and reports
+// whether every file was generated
+func (g *generator) run(entities []Entity) bool {
+	if g.verbose {
+		fmt.Printf("%v\n\n", strings.Join(lo.Map(entities, func(item Entity, index int) string { return item.EntityName }), ","))
 	}
 
-	// Parse input file and create output directories
-	entities, err := parseInputFile(inputFile)
+	AssignRelations(entities)
+
+	previous, err := loadManifest(g.outputDir)
 	if err != nil {
-		fmt.Printf("Error processing input: %v\n", err)
-		return
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return false
 	}
+	g.previous, g.next = previous, newManifest()
 
-	fmt.Printf("%v\n\n", strings.Join(lo.Map(entities, func(item Entity, index int) string { return item.EntityName }), ","))
-
-	AssignRelations(entities)
+	// Create base output directory
+	if !g.dryRun {
+		if err := createOutputDirectories(g.outputDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output directories: %v\n", err)
+			return false
+		}
+	}
 
-	fmt.Printf("%v\n\n", strings.Join(lo.Map(entities, func(item Entity, index int) string { return item.EntityName }), ","))
+	jobs := g.genericJobs(entities)
+	for _, entity := range entities {
+		jobs = append(jobs, g.entityJobs(entity)...)
+	}
+	if err := g.parseTemplates(jobs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return false
+	}
 
-	// Create base output directory
-	if err := createOutputDirectories(outputDir); err != nil {
-		fmt.Printf("Error creating output directories: %v\n", err)
-		return
+	// Render concurrently, then report and write in job order
+	var errs []string
+	failed := make(map[string]bool)
+	for _, result := range g.renderAll(jobs) {
+		if err := g.apply(result); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", result.job.filePath, err))
+			failed[result.job.entityName] = true
+		}
 	}
 
-	// Determine module name (for imports)
-	moduleName := os.Getenv("MODULE_NAME")
-	if moduleName == "" {
-		moduleName = "github.com/space-w-alker/campus-nexus/internal/server"
+	if !g.quiet && !g.dryRun {
+		for _, entity := range entities {
+			if !failed[entity.EntityName] {
+				fmt.Printf("Generated code for %s in %s\n", entity.EntityName, g.outputDir)
+			}
+		}
+	}
+	ok := len(errs) == 0
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error generating %d files:\n  %s\n", len(errs), strings.Join(errs, "\n  "))
 	}
 
-	if err := generateGenericCode(outputDir, moduleName, entities); err != nil {
-		fmt.Printf("Error generating generic code: %v", err)
+	if !g.handleOrphans() {
+		ok = false
 	}
 
-	// Generate code for each entity
-	for _, entity := range entities {
-		if err := generateEntityCode(entity, outputDir, moduleName); err != nil {
-			fmt.Printf("Error generating code for entity %s: %v\n", entity.EntityName, err)
-		} else {
-			fmt.Printf("Generated code for %s in %s\n", entity.EntityName, outputDir)
+	if !g.dryRun {
+		if err := g.next.save(g.outputDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", manifestName, err)
+			ok = false
 		}
 	}
+
+	if !g.quiet && (g.dryRun || g.verbose) {
+		fmt.Printf("\n%s\n", g.summary())
+	}
+	return ok
 }
 
-// parseInputFile reads and parses the input JSON file
+// parseInputFile reads and parses the input file, JSON, YAML (.yaml/.yml) or HCL (.hcl)
 func parseInputFile(inputFile string) ([]Entity, error) {
 	// Read input file
 	inputData, err := os.ReadFile(inputFile)
@@ -370,17 +1209,120 @@ func parseInputFile(inputFile string) ([]Entity, error) {
 		return nil, fmt.Errorf("error reading input file: %v", err)
 	}
 
-	// Parse JSON
-	var entities []Entity
-	err = json.Unmarshal(inputData, &entities)
+	inputData, source, err := toJSONInput(inputFile, inputData)
 	if err != nil {
-		// Try parsing as a single entity
-		var singleEntity Entity
-		if err = json.Unmarshal(inputData, &singleEntity); err != nil {
-			return nil, fmt.Errorf("error parsing JSON: %v", err)
+		return nil, fmt.Errorf("error parsing input: %v", err)
+	}
+
+	if isDesignSchema(inputData) {
+		entities, err := parseDesignSchema(inputData)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", inputFile, err)
+		}
+		for i := range entities {
+			entities[i].source.File = inputFile
 		}
+		return entities, nil
+	}
+
+	// Parse either an array of entities or a single entity
+	var entities []Entity
+	trimmed := bytes.TrimSpace(inputData)
+	isArray := len(trimmed) > 0 && trimmed[0] == '['
+	if isArray {
+		err = json.Unmarshal(inputData, &entities)
+	} else {
+		var singleEntity Entity
+		err = json.Unmarshal(inputData, &singleEntity)
 		entities = []Entity{singleEntity}
 	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing input: %v", source.wrap(err))
+	}
+
+	for i := range entities {
+		entities[i].source = schemaLocation{File: inputFile}
+		if isArray {
+			entities[i].source.Pointer = "/" + strconv.Itoa(i)
+		}
+	}
+
+	return entities, nil
+}
+
+// schemaExtensions lists the file types picked up when the input is a directory
+var schemaExtensions = []string{".json", ".yaml", ".yml", ".hcl"}
+
+// resolveInputFiles expands the input argument into the schema files it names:
+// the file itself, every schema file below a directory, or the matches of a glob
+func resolveInputFiles(input string) ([]string, error) {
+	if strings.ContainsAny(input, "*?[") {
+		matches, err := filepath.Glob(input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input pattern %s: %v", input, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no input files match %s", input)
+		}
+		sort.Strings(matches)
+		return matches, nil
+	}
+
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, fmt.Errorf("error reading input file: %v", err)
+	}
+	if !info.IsDir() {
+		return []string{input}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(input, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && lo.Contains(schemaExtensions, strings.ToLower(filepath.Ext(path))) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading input directory %s: %v", input, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no schema files found in %s", input)
+	}
+	return files, nil
+}
+
+// parseInputs parses every file named by the input arguments and merges the
+// entities in file order. An entity name defined twice is an error.
+func parseInputs(inputs []string) ([]Entity, error) {
+	var files []string
+	for _, input := range inputs {
+		resolved, err := resolveInputFiles(input)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, resolved...)
+	}
+	files = lo.Uniq(files)
+
+	var entities []Entity
+	definedAt := make(map[string]schemaLocation)
+	for _, file := range files {
+		fileEntities, err := parseInputFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, entity := range fileEntities {
+			if previous, exists := definedAt[entity.EntityName]; exists {
+				return nil, fmt.Errorf("entity %s is defined twice, at %s and %s", entity.EntityName, previous, entity.source)
+			}
+			definedAt[entity.EntityName] = entity.source
+		}
+		entities = append(entities, fileEntities...)
+	}
 
 	return entities, nil
 }
@@ -406,52 +1348,87 @@ func createOutputDirectories(outputDir string) error {
 	return nil
 }
 
-func generateGenericCode(outputDir string, moduleName string, data []Entity) error {
+// fileJob is one output file of a run
+type fileJob struct {
+	filePath     string
+	templateName string
+	// entityName is empty for files shared by all entities
+	entityName string
+	data       interface{}
+	skipExists bool
+}
+
+// fileResult is a rendered file, ready to be reported and written
+type fileResult struct {
+	job      fileJob
+	status   fileStatus
+	existing []byte
+	content  []byte
+	entry    manifestEntry
+	warning  string
+	err      error
+}
+
+func (g *generator) genericJobs(data []Entity) []fileJob {
+	moduleName := g.moduleName
 	temp := strings.Split(moduleName, "/")
 	packageName := temp[len(temp)-1]
 	d := struct {
-		Entities    []Entity
-		PackageName string
-		ModuleName  string
-	}{Entities: data, PackageName: packageName, ModuleName: moduleName}
-	if err := generateFileFromTemplate(path.Join(outputDir, "dto", "utils.go"), path.Join("templates", "dto_utils.tmpl"), struct{}{}, true); err != nil {
-		return err
-	}
-	if err := generateFileFromTemplate(path.Join(outputDir, "repositories", "utils.go"), path.Join("templates", "repository_utils.tmpl"), d, true); err != nil {
-		return err
-	}
-	if err := generateFileFromTemplate(path.Join(outputDir, "models", "utils.go"), path.Join("templates", "model_utils.tmpl"), struct{}{}, true); err != nil {
-		return err
-	}
-	if err := generateFileFromTemplate(path.Join(outputDir, "wire.go"), path.Join("templates", "wire.tmpl"), d, true); err != nil {
-		return err
-	}
-	if err := generateFileFromTemplate(path.Join(outputDir, "database.go"), path.Join("templates", "database.tmpl"), d, false); err != nil {
-		return err
-	}
-	if err := generateFileFromTemplate(path.Join(outputDir, "server.go"), path.Join("templates", "server.tmpl"), d, true); err != nil {
-		return err
+		Entities            []Entity
+		PackageName         string
+		ModuleName          string
+		RequiresAuth        bool
+		RegistersValidators bool
+	}{
+		Entities:    data,
+		PackageName: packageName,
+		ModuleName:  moduleName,
+		RequiresAuth: lo.SomeBy(data, func(entity Entity) bool {
+			return entity.HasAuthenticatedEndpoints()
+		}),
+		RegistersValidators: lo.SomeBy(data, func(entity Entity) bool {
+			return entity.HasValidators()
+		}),
 	}
-	if err := generateFileFromTemplate(path.Join(outputDir, "repositories", "auth_service.go"), path.Join("templates", "auth_service.tmpl"), d, true); err != nil {
-		return err
+	jobs := []fileJob{
+		{path.Join(g.outputDir, "dto", "utils.go"), "dto_utils.tmpl", "", struct{}{}, true},
+		{path.Join(g.outputDir, "dto", "validation.go"), "validation.tmpl", "", d, false},
+		{path.Join(g.outputDir, "repositories", "utils.go"), "repository_utils.tmpl", "", d, true},
+		{path.Join(g.outputDir, "repositories", "sort.go"), "repository_sort.tmpl", "", d, false},
+		{path.Join(g.outputDir, "repositories", "query.go"), "repository_query.tmpl", "", d, false},
+		{path.Join(g.outputDir, "models", "utils.go"), "model_utils.tmpl", "", struct{}{}, true},
+		{path.Join(g.outputDir, "wire.go"), "wire.tmpl", "", d, true},
+		{path.Join(g.outputDir, "database.go"), "database.tmpl", "", d, false},
+		{path.Join(g.outputDir, "server.go"), "server.tmpl", "", d, true},
+		{path.Join(g.outputDir, "errs", "errs.go"), "errs.tmpl", "", d, true},
+		{path.Join(g.outputDir, "errs/errcodes", "errcodes.go"), "errcodes.tmpl", "", d, true},
 	}
-	if err := generateFileFromTemplate(path.Join(outputDir, "controllers", "auth_controller.go"), path.Join("templates", "auth_controller.tmpl"), d, true); err != nil {
-		return err
+	// The auth scaffold works on a User model, so it is only written once an
+	// endpoint needs it
+	if d.RequiresAuth {
+		jobs = append(jobs,
+			fileJob{path.Join(g.outputDir, "repositories", "auth_service.go"), "auth_service.tmpl", "", d, true},
+			fileJob{path.Join(g.outputDir, "controllers", "auth_controller.go"), "auth_controller.tmpl", "", d, true},
+			fileJob{path.Join(g.outputDir, "middleware", "auth_middleware.go"), "middleware.tmpl", "", d, true})
 	}
-	if err := generateFileFromTemplate(path.Join(outputDir, "errs", "errs.go"), path.Join("templates", "errs.tmpl"), d, true); err != nil {
-		return err
+	if lo.SomeBy(data, func(entity Entity) bool { return entity.AdditionalFeatures.SoftDelete }) {
+		jobs = append(jobs,
+			fileJob{path.Join(g.outputDir, "dto", "soft_delete.go"), "dto_soft_delete.tmpl", "", d, false},
+			fileJob{path.Join(g.outputDir, "repositories", "soft_delete.go"), "repository_soft_delete.tmpl", "", d, false})
 	}
-	if err := generateFileFromTemplate(path.Join(outputDir, "errs/errcodes", "errcodes.go"), path.Join("templates", "errcodes.tmpl"), d, true); err != nil {
-		return err
+	if lo.SomeBy(data, func(entity Entity) bool { return entity.HasTimeFilters() }) {
+		jobs = append(jobs, fileJob{path.Join(g.outputDir, "dto", "filters.go"), "dto_filters.tmpl", "", d, false})
 	}
-	if err := generateFileFromTemplate(path.Join(outputDir, "middleware", "auth_middleware.go"), path.Join("templates", "middleware.tmpl"), d, true); err != nil {
-		return err
+	if lo.SomeBy(data, func(entity Entity) bool { return entity.UsesCursorPagination() }) {
+		jobs = append(jobs,
+			fileJob{path.Join(g.outputDir, "dto", "cursor.go"), "dto_cursor.tmpl", "", d, false},
+			fileJob{path.Join(g.outputDir, "repositories", "cursor.go"), "repository_cursor.tmpl", "", d, false})
 	}
-	return nil
+	return jobs
 }
 
-// generateEntityCode generates code files for a single entity
-func generateEntityCode(entity Entity, outputDir, moduleName string) error {
+// entityJobs lists the code files of a single entity
+func (g *generator) entityJobs(entity Entity) []fileJob {
 	// Create template data with all necessary fields
 	templateData := struct {
 		*Entity
@@ -459,53 +1436,20 @@ func generateEntityCode(entity Entity, outputDir, moduleName string) error {
 		EntityNameLower string
 	}{
 		Entity:          &entity,
-		ModuleName:      moduleName,
+		ModuleName:      g.moduleName,
 		EntityNameLower: strings.ToLower(entity.EntityName),
 	}
 
-	modelPath := filepath.Join(outputDir, "models", lo.SnakeCase(entity.EntityName)+".go")
-	modelTempPath := filepath.Join("templates", "model.tmpl")
-	if err := generateFileFromTemplate(modelPath, modelTempPath, templateData, false); err != nil {
-		return fmt.Errorf("error generating file %s: %v", modelPath, err)
-	}
-
-	baseDtoPath := filepath.Join(outputDir, "dto", lo.SnakeCase(entity.EntityName)+"_base.go")
-	baseDtoTempPath := filepath.Join("templates", "dto_base.tmpl")
-	if err := generateFileFromTemplate(baseDtoPath, baseDtoTempPath, templateData, false); err != nil {
-		return fmt.Errorf("error generating file %s: %v", baseDtoPath, err)
-	}
-
-	dtoPath := filepath.Join(outputDir, "dto", lo.SnakeCase(entity.EntityName)+".go")
-	dtoTempPath := filepath.Join("templates", "dto.tmpl")
-	if err := generateFileFromTemplate(dtoPath, dtoTempPath, templateData, true); err != nil {
-		return fmt.Errorf("error generating file %s: %v", dtoPath, err)
+	name := lo.SnakeCase(entity.EntityName)
+	return []fileJob{
+		{filepath.Join(g.outputDir, "models", name+".go"), "model.tmpl", entity.EntityName, templateData, false},
+		{filepath.Join(g.outputDir, "dto", name+"_base.go"), "dto_base.tmpl", entity.EntityName, templateData, false},
+		{filepath.Join(g.outputDir, "dto", name+".go"), "dto.tmpl", entity.EntityName, templateData, true},
+		{filepath.Join(g.outputDir, "repositories", name+"_base.go"), "repository_base.tmpl", entity.EntityName, templateData, false},
+		{filepath.Join(g.outputDir, "repositories", name+".go"), "repository.tmpl", entity.EntityName, templateData, true},
+		{filepath.Join(g.outputDir, "controllers", name+"_base.go"), "controller_base.tmpl", entity.EntityName, templateData, false},
+		{filepath.Join(g.outputDir, "controllers", name+".go"), "controller.tmpl", entity.EntityName, templateData, true},
 	}
-
-	baseRepositoryPath := filepath.Join(outputDir, "repositories", lo.SnakeCase(entity.EntityName)+"_base.go")
-	baseRepositoryTempPath := filepath.Join("templates", "repository_base.tmpl")
-	if err := generateFileFromTemplate(baseRepositoryPath, baseRepositoryTempPath, templateData, false); err != nil {
-		return fmt.Errorf("error generating file %s: %v", baseRepositoryPath, err)
-	}
-
-	repositoryPath := filepath.Join(outputDir, "repositories", lo.SnakeCase(entity.EntityName)+".go")
-	repositoryTempPath := filepath.Join("templates", "repository.tmpl")
-	if err := generateFileFromTemplate(repositoryPath, repositoryTempPath, templateData, true); err != nil {
-		return fmt.Errorf("error generating file %s: %v", repositoryPath, err)
-	}
-
-	baseControllersPath := filepath.Join(outputDir, "controllers", lo.SnakeCase(entity.EntityName)+"_base.go")
-	baseControllersTempPath := filepath.Join("templates", "controller_base.tmpl")
-	if err := generateFileFromTemplate(baseControllersPath, baseControllersTempPath, templateData, false); err != nil {
-		return fmt.Errorf("error generating file %s: %v", baseControllersPath, err)
-	}
-
-	controllerPath := filepath.Join(outputDir, "controllers", lo.SnakeCase(entity.EntityName)+".go")
-	controllerTempPath := filepath.Join("templates", "controller.tmpl")
-	if err := generateFileFromTemplate(controllerPath, controllerTempPath, templateData, true); err != nil {
-		return fmt.Errorf("error generating file %s: %v", controllerPath, err)
-	}
-
-	return nil
 }
 
 func fileExists(filename string) bool {
@@ -513,29 +1457,75 @@ func fileExists(filename string) bool {
 	return err == nil || !os.IsNotExist(err)
 }
 
-// generateFileFromTemplate creates a file from a template with the given data
-func generateFileFromTemplate(filePath, templatePath string, data interface{}, skipExists bool) error {
-	// Read the template file
+// parseTemplates parses every template the jobs use, once
+func (g *generator) parseTemplates(jobs []fileJob) error {
+	g.templates = make(map[string]*template.Template)
+	for _, job := range jobs {
+		if _, ok := g.templates[job.templateName]; ok {
+			continue
+		}
 
-	if skipExists && fileExists(filePath) {
-		return nil
+		// Read the template file
+		templateContent, err := g.readTemplate(job.templateName)
+		if err != nil {
+			return err
+		}
+
+		// Parse the template
+		tmpl, err := template.New(job.templateName).Funcs(templateFuncs).Parse(string(templateContent))
+		if err != nil {
+			return fmt.Errorf("error parsing template %s: %v", job.templateName, err)
+		}
+		g.templates[job.templateName] = tmpl
 	}
+	return nil
+}
 
-	templateContent, err := os.ReadFile(templatePath)
-	if err != nil {
-		return fmt.Errorf("error reading template file %s: %v", templatePath, err)
+// renderAll renders the jobs on a bounded pool of workers. Results come back
+// in job order, so reporting and writing them stays deterministic.
+func (g *generator) renderAll(jobs []fileJob) []fileResult {
+	results := make([]fileResult, len(jobs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(1, min(g.workers, len(jobs))); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = g.render(jobs[i])
+			}
+		}()
+	}
+	for i := range jobs {
+		indexes <- i
 	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
 
-	// Parse the template
-	tmpl, err := template.New(filepath.Base(filePath)).Funcs(templateFuncs).Parse(string(templateContent))
+// render produces the content of a file from its template. Files with
+// skipExists are owned by the user once created: later runs only refresh their
+// generated regions, unless the run is forced. render only reads from disk and
+// is safe to call concurrently.
+func (g *generator) render(job fileJob) fileResult {
+	result := fileResult{job: job}
+	fail := func(err error) fileResult {
+		result.err = err
+		return result
+	}
+
+	userOwned := job.skipExists && !g.force && fileExists(job.filePath)
+	hash, err := inputHash(job.data)
 	if err != nil {
-		return fmt.Errorf("error parsing template: %v", err)
+		return fail(fmt.Errorf("error hashing template data: %v", err))
 	}
+	result.entry = manifestEntry{Template: job.templateName, Entity: job.entityName, UserOwned: job.skipExists, InputHash: hash}
 
 	// Execute the template to a buffer first
 	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return fmt.Errorf("error executing template: %v", err)
+	if err := g.templates[job.templateName].Execute(&buf, job.data); err != nil {
+		return fail(fmt.Errorf("error executing template: %v", err))
 	}
 
 	// Format the Go code
@@ -543,21 +1533,102 @@ func generateFileFromTemplate(filePath, templatePath string, data interface{}, s
 	if err != nil {
 		// If formatting fails, we can either return the error or proceed with unformatted code
 		// Here we choose to return the error
-		return fmt.Errorf("error formatting output: %v", err)
+		return fail(fmt.Errorf("error formatting output: %v", err))
+	}
+
+	if userOwned {
+		return g.mergeUserOwned(result, formattedSource)
 	}
 
-	// Create the file
-	file, err := os.Create(filePath)
+	result.status, result.existing, err = compareOutput(job.filePath, formattedSource)
 	if err != nil {
-		return fmt.Errorf("error creating file: %v", err)
+		return fail(err)
+	}
+	result.content = formattedSource
+
+	// Regenerated files must still match what the last run wrote
+	if previous, ok := g.previous.Files[g.manifestKey(job.filePath)]; ok && result.status == fileModified && !job.skipExists && !g.force && checksum(result.existing) != previous.Checksum {
+		result.status = fileConflict
+		result.entry = previous
+		if !g.dryRun {
+			result.err = fmt.Errorf("the file was edited by hand since it was generated; move the changes to a user owned file or rerun with --force")
+		}
+		return result
 	}
-	defer file.Close()
 
-	// Write the formatted content to the file
-	if _, err := file.Write(formattedSource); err != nil {
-		return fmt.Errorf("error writing to file: %v", err)
+	result.entry.Checksum = checksum(formattedSource)
+	return result
+}
+
+// mergeUserOwned refreshes the generated regions of an existing user owned file
+func (g *generator) mergeUserOwned(result fileResult, rendered []byte) fileResult {
+	existing, err := os.ReadFile(result.job.filePath)
+	if err != nil {
+		result.err = fmt.Errorf("error reading existing file: %v", err)
+		return result
+	}
+	if !hasRegions(rendered) || !hasRegions(existing) {
+		result.status = fileSkipped
+		result.entry.Checksum = checksum(existing)
+		return result
 	}
 
+	merged, missing, err := mergeRegions(existing, rendered)
+	if err != nil {
+		result.err = fmt.Errorf("error merging generated regions: %v", err)
+		return result
+	}
+
+	result.status = fileUnchanged
+	if !bytes.Equal(merged, existing) {
+		// The refreshed regions may use what the missing ones declare, such as
+		// a struct field or an import, so refreshing only some of them could
+		// leave the file broken
+		if len(missing) > 0 {
+			result.status = fileConflict
+			result.existing, result.content = existing, merged
+			result.entry.Checksum = checksum(existing)
+			if !g.dryRun {
+				result.err = fmt.Errorf("the file has no generated region %s, which the refreshed regions may depend on; add the markers where the template has them, or rerun with --force to rewrite the file", strings.Join(missing, ", "))
+			}
+			return result
+		}
+		result.status = fileModified
+		if merged, err = format.Source(merged); err != nil {
+			result.err = fmt.Errorf("error formatting merged file: %v", err)
+			return result
+		}
+	}
+	if len(missing) > 0 {
+		result.warning = fmt.Sprintf("%s has no generated region %s; add the markers to keep it up to date", result.job.filePath, strings.Join(missing, ", "))
+	}
+	result.existing, result.content = existing, merged
+	result.entry.Checksum = checksum(merged)
+	return result
+}
+
+// apply reports a rendered file, records it in the manifest and writes it
+func (g *generator) apply(result fileResult) error {
+	if result.status == "" {
+		return result.err
+	}
+	if result.warning != "" && !g.quiet {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", result.warning)
+	}
+
+	filePath := result.job.filePath
+	g.next.Files[g.manifestKey(filePath)] = result.entry
+	g.report(filePath, result.status, result.existing, result.content)
+	if result.err != nil {
+		return result.err
+	}
+	if g.dryRun || (result.status != fileCreated && result.status != fileModified) {
+		return nil
+	}
+
+	if err := os.WriteFile(filePath, result.content, 0644); err != nil {
+		return fmt.Errorf("error writing to file: %v", err)
+	}
 	return nil
 }
 
@@ -566,7 +1637,13 @@ func AssignRelations(entities []Entity) {
 		entity := &entities[i]
 		for j := range entity.Relations {
 			relation := &entity.Relations[j]
-			if relation.ForeignKey != "" {
+			if _, index, ok := lo.FindIndexOf(entities, func(e Entity) bool { return e.EntityName == relation.RelatedEntity }); ok {
+				key := entities[index].GetPrimaryKey()
+				relation.relatedKey = &key
+				relation.related = &entities[index]
+			}
+			// The foreignKey of a ManyToMany relation names its join table
+			if relation.ForeignKey != "" || relation.RelationType == "ManyToMany" {
 				continue
 			}
 			for k := range entities {
@@ -583,40 +1660,98 @@ func AssignRelations(entities []Entity) {
 			}
 		}
 	}
+
+	for i := range entities {
+		entity := &entities[i]
+		for j := range entity.Relations {
+			relation := &entity.Relations[j]
+			switch {
+			case ownsForeignKey(*relation):
+				relation.keyField = fieldWithColumn(*entity, foreignKeyColumn(relation.FieldName))
+			case relation.RelationType == "OneToMany":
+				if related, ok := lo.Find(entities, func(e Entity) bool { return e.EntityName == relation.RelatedEntity }); ok {
+					relation.keyField = fieldWithColumn(related, foreignKeyColumn(lo.CamelCase(lo.CoalesceOrEmpty(relation.ForeignKey, entity.EntityName))))
+				}
+			}
+		}
+	}
+}
+
+// foreignKeyColumn is the column of the foreign key a relation field adds
+func foreignKeyColumn(fieldName string) string {
+	return toSnakeCase(fieldName) + "_id"
+}
+
+// fieldWithColumn returns the Go name of the declared field stored in column,
+// or "" if there is none
+func fieldWithColumn(entity Entity, column string) string {
+	field, ok := lo.Find(entity.Fields, func(field Field) bool { return !field.Virtual && lo.SnakeCase(field.FieldName) == column })
+	if !ok {
+		return ""
+	}
+	return toGoFieldName(field.FieldName)
+}
+
+// ownsForeignKey reports whether a relation adds a foreign key column to the
+// entity declaring it
+func ownsForeignKey(relation Relation) bool {
+	return relation.RelationType == "ManyToOne" || (relation.RelationType == "OneToOne" && !relation.OneToOneOwner)
+}
+
+// entityDependencies lists the entities whose tables entity has a foreign key
+// to: the targets of its ManyToOne and non-owning OneToOne relations, and the
+// owners of OneToMany relations targeting it. Self references are left out.
+func entityDependencies(entity Entity, entities []Entity) []string {
+	var dependencies []string
+	for _, relation := range entity.Relations {
+		if ownsForeignKey(relation) {
+			dependencies = append(dependencies, relation.RelatedEntity)
+		}
+	}
+	for _, other := range entities {
+		for _, relation := range other.Relations {
+			if relation.RelationType == "OneToMany" && relation.RelatedEntity == entity.EntityName {
+				dependencies = append(dependencies, other.EntityName)
+			}
+		}
+	}
+	return lo.Uniq(lo.Without(dependencies, entity.EntityName))
 }
 
 // TopologicalSortEntities sorts entities by their dependencies
 // Entities with no dependencies will be first in the returned slice
 // Entities with dependencies will follow their dependencies
+// Entities that don't depend on each other keep their input order
 func TopologicalSortEntities(entities []Entity) ([]Entity, error) {
 	// Create a graph representation of dependencies
 	graph := make(map[string][]string)
+	// Entities depending on each entity, the reverse of graph
+	dependents := make(map[string][]string)
 	// Track in-degree (number of dependencies) for each entity
 	inDegree := make(map[string]int)
 
-	// Initialize maps with all entity names
+	entityMap := make(map[string]Entity)
 	for _, entity := range entities {
-		graph[entity.EntityName] = []string{}
-		inDegree[entity.EntityName] = 0
+		entityMap[entity.EntityName] = entity
 	}
 
 	// Build the dependency graph and in-degree counts
 	for _, entity := range entities {
-		for _, relation := range entity.Relations {
-			// Only consider ManyToOne relationships as dependencies
-			if relation.RelationType == "ManyToOne" {
-				// This entity depends on the related entity
-				graph[entity.EntityName] = append(graph[entity.EntityName], relation.RelatedEntity)
-				inDegree[relation.RelatedEntity]++
+		for _, dependency := range entityDependencies(entity, entities) {
+			if _, ok := entityMap[dependency]; !ok {
+				continue
 			}
+			graph[entity.EntityName] = append(graph[entity.EntityName], dependency)
+			dependents[dependency] = append(dependents[dependency], entity.EntityName)
+			inDegree[entity.EntityName]++
 		}
 	}
 
 	// Queue for entities with no dependencies (in-degree of 0)
 	var queue []string
-	for entityName, degree := range inDegree {
-		if degree == 0 {
-			queue = append(queue, entityName)
+	for _, entity := range entities {
+		if inDegree[entity.EntityName] == 0 {
+			queue = append(queue, entity.EntityName)
 		}
 	}
 
@@ -633,7 +1768,7 @@ func TopologicalSortEntities(entities []Entity) ([]Entity, error) {
 		sortedNames = append(sortedNames, current)
 
 		// For each entity that depends on the current entity
-		for _, dependent := range graph[current] {
+		for _, dependent := range dependents[current] {
 			// Reduce in-degree by 1
 			inDegree[dependent]--
 
@@ -651,16 +1786,8 @@ func TopologicalSortEntities(entities []Entity) ([]Entity, error) {
 		return nil, fmt.Errorf("cycle(s) detected in entity dependencies: %v", cycles)
 	}
 
-	// Create result slice in correct order
-	result := make([]Entity, len(entities))
-	entityMap := make(map[string]Entity)
-
-	// Create map for easy lookup
-	for _, entity := range entities {
-		entityMap[entity.EntityName] = entity
-	}
-
 	// Populate result slice in sorted order
+	result := make([]Entity, len(entities))
 	for i, name := range sortedNames {
 		result[i] = entityMap[name]
 	}
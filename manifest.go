@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// manifestName is the file in the output directory recording what was generated
+const manifestName = ".crudgen.lock"
+
+const manifestVersion = 1
+
+// manifestEntry records how one output file was produced
+type manifestEntry struct {
+	Template string `json:"template"`
+	// Entity is empty for files shared by all entities
+	Entity    string `json:"entity,omitempty"`
+	UserOwned bool   `json:"userOwned,omitempty"`
+	// InputHash covers the template data, Checksum the file as written
+	InputHash string `json:"inputHash"`
+	Checksum  string `json:"checksum"`
+}
+
+type manifest struct {
+	Version int `json:"version"`
+	// Files is keyed by slash separated paths relative to the output directory
+	Files map[string]manifestEntry `json:"files"`
+}
+
+func newManifest() *manifest {
+	return &manifest{Version: manifestVersion, Files: map[string]manifestEntry{}}
+}
+
+// loadManifest reads the manifest of outputDir. A missing manifest is empty.
+func loadManifest(outputDir string) (*manifest, error) {
+	data, err := os.ReadFile(filepath.Join(outputDir, manifestName))
+	if os.IsNotExist(err) {
+		return newManifest(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", manifestName, err)
+	}
+
+	m := newManifest()
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", manifestName, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("%s has version %d, expected %d", manifestName, m.Version, manifestVersion)
+	}
+	if m.Files == nil {
+		m.Files = map[string]manifestEntry{}
+	}
+	return m, nil
+}
+
+func (m *manifest) save(outputDir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, manifestName), append(data, '\n'), 0644)
+}
+
+// orphans lists the files of m that next no longer generates, sorted
+func (m *manifest) orphans(next *manifest) []string {
+	var paths []string
+	for path := range m.Files {
+		if _, ok := next.Files[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// inputHash fingerprints the data a template was rendered with
+func inputHash(data interface{}) (string, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return checksum(encoded), nil
+}
+
+// manifestKey returns the manifest path of a file in the output directory
+func (g *generator) manifestKey(filePath string) string {
+	rel, err := filepath.Rel(g.outputDir, filePath)
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// handleOrphans deals with the files of the previous run that this run didn't
+// generate. Without pruning they are reported and kept in the manifest. With
+// pruning, regenerated files are deleted; user owned files only with
+// pruneUserOwned, and files edited by hand only when forced.
+func (g *generator) handleOrphans() bool {
+	var kept []string
+	ok := true
+	for _, key := range g.previous.orphans(g.next) {
+		entry := g.previous.Files[key]
+		filePath := filepath.Join(g.outputDir, filepath.FromSlash(key))
+		content, err := os.ReadFile(filePath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", filePath, err)
+			g.next.Files[key] = entry
+			ok = false
+			continue
+		}
+
+		switch {
+		case !g.prune:
+			kept = append(kept, key)
+		case entry.UserOwned && !g.pruneUserOwned:
+			g.report(filePath, fileSkipped, nil, nil)
+			kept = append(kept, key)
+		case !entry.UserOwned && !g.force && checksum(content) != entry.Checksum:
+			g.report(filePath, fileConflict, nil, nil)
+			kept = append(kept, key)
+		default:
+			g.report(filePath, fileDeleted, nil, nil)
+			if g.dryRun {
+				continue
+			}
+			if err := os.Remove(filePath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error deleting %s: %v\n", filePath, err)
+				g.next.Files[key] = entry
+				ok = false
+			}
+			continue
+		}
+		g.next.Files[key] = entry
+	}
+
+	if len(kept) > 0 && !g.quiet {
+		hint := "pass --prune to delete them"
+		if g.prune {
+			hint = "user owned files need --prune-user-owned and files edited by hand --force"
+		}
+		fmt.Fprintf(os.Stderr, "Warning: kept %d files of entities no longer in the schema (%s): %s\n", len(kept), hint, strings.Join(kept, ", "))
+	}
+	return ok
+}
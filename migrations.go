@@ -0,0 +1,568 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/inflection"
+	"github.com/samber/lo"
+)
+
+// sqlSchema is the Postgres schema the generated models map to. The migrate
+// command writes it out as SQL for databases that can't rely on AutoMigrate,
+// which never drops columns or constraints.
+type sqlSchema struct {
+	EnumTypes []sqlEnumType `json:"enumTypes,omitempty"`
+	// Tables are in creation order, every table after those it references
+	// unless the references form a cycle
+	Tables []sqlTable `json:"tables"`
+}
+
+// sqlEnumType is the native enum type of a field with enumConstraint "native"
+type sqlEnumType struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// sqlTable is the table of an entity or the join table of a ManyToMany relation
+type sqlTable struct {
+	Name string `json:"name"`
+	// Entity is empty for join tables
+	Entity      string          `json:"entity,omitempty"`
+	Columns     []sqlColumn     `json:"columns"`
+	PrimaryKey  []string        `json:"primaryKey,omitempty"`
+	ForeignKeys []sqlForeignKey `json:"foreignKeys,omitempty"`
+	Indexes     []sqlIndex      `json:"indexes,omitempty"`
+}
+
+type sqlColumn struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	NotNull bool   `json:"notNull,omitempty"`
+	// Default is an SQL expression
+	Default string `json:"default,omitempty"`
+	Unique  bool   `json:"unique,omitempty"`
+	// Check is the condition of the column's CHECK constraint
+	Check string `json:"check,omitempty"`
+	// Identity columns are filled from a sequence, as integer primary keys are
+	Identity bool `json:"identity,omitempty"`
+}
+
+type sqlForeignKey struct {
+	Name      string `json:"name"`
+	Column    string `json:"column"`
+	RefTable  string `json:"refTable"`
+	RefColumn string `json:"refColumn"`
+	OnDelete  string `json:"onDelete,omitempty"`
+	OnUpdate  string `json:"onUpdate,omitempty"`
+}
+
+type sqlIndex struct {
+	Name   string `json:"name"`
+	Column string `json:"column"`
+}
+
+func (table *sqlTable) foreignKey(column string) *sqlForeignKey {
+	for i := range table.ForeignKeys {
+		if table.ForeignKeys[i].Column == column {
+			return &table.ForeignKeys[i]
+		}
+	}
+	return nil
+}
+
+// buildSQLSchema derives the tables of the models generated for entities, with
+// the columns and constraints their gorm tags declare. AssignRelations must
+// have run on entities.
+func buildSQLSchema(entities []Entity) sqlSchema {
+	// A cycle of foreign keys has no creation order; renderCreateSchema adds the
+	// keys that point to tables created later once all tables exist
+	ordered, err := TopologicalSortEntities(entities)
+	if err != nil {
+		ordered = entities
+	}
+	byName := lo.KeyBy(entities, func(entity Entity) string { return entity.EntityName })
+
+	var schema sqlSchema
+	tableIndex := make(map[string]int)
+	for _, entity := range ordered {
+		tableName := entity.GetTableName()
+		for _, field := range entity.Fields {
+			if field.IsEnum() && field.EnumConstraint == "native" && !field.Virtual {
+				schema.EnumTypes = append(schema.EnumTypes, sqlEnumType{Name: enumSQLType(tableName, field), Values: field.Values})
+			}
+		}
+		tableIndex[entity.EntityName] = len(schema.Tables)
+		schema.Tables = append(schema.Tables, entityTable(entity, byName))
+	}
+
+	// The foreign key of a OneToMany relation lives on the related table, which
+	// normally declares it with its ManyToOne side; the OneToMany side decides
+	// what happens on delete
+	for _, entity := range ordered {
+		for _, relation := range entity.Relations {
+			i, ok := tableIndex[relation.RelatedEntity]
+			if relation.RelationType != "OneToMany" || !ok {
+				continue
+			}
+			child := &schema.Tables[i]
+			column := foreignKeyColumn(lo.CamelCase(lo.CoalesceOrEmpty(relation.ForeignKey, entity.EntityName)))
+			fk := child.foreignKey(column)
+			if fk == nil {
+				if _, exists := findColumn(*child, column); !exists {
+					child.Columns = append(child.Columns, sqlColumn{Name: column, Type: primaryKeyColumnType(entity)})
+				}
+				child.ForeignKeys = append(child.ForeignKeys, referenceTo(child.Name, column, entity))
+				fk = &child.ForeignKeys[len(child.ForeignKeys)-1]
+			}
+			fk.OnDelete, fk.OnUpdate = "SET NULL", "SET NULL"
+			if relation.Cascade {
+				fk.OnDelete, fk.OnUpdate = "CASCADE", "CASCADE"
+			}
+		}
+	}
+
+	// Both sides of a ManyToMany relation share the join table
+	joined := make(map[string]bool)
+	for _, entity := range ordered {
+		for _, relation := range entity.Relations {
+			related, ok := byName[relation.RelatedEntity]
+			name := joinTableName(entity.EntityName, relation)
+			if relation.RelationType != "ManyToMany" || !ok || joined[name] {
+				continue
+			}
+			joined[name] = true
+			// Like its name, the column order of the join table doesn't depend
+			// on the side the relation is found on first
+			owner := entity
+			if strings.ToLower(related.EntityName) < strings.ToLower(entity.EntityName) {
+				owner, related = related, entity
+			}
+			schema.Tables = append(schema.Tables, joinTable(name, owner, related, relation))
+		}
+	}
+	return schema
+}
+
+func entityTable(entity Entity, byName map[string]Entity) sqlTable {
+	tableName := entity.GetTableName()
+	table := sqlTable{Name: tableName, Entity: entity.EntityName}
+
+	for _, field := range entity.Fields {
+		if field.Virtual {
+			continue
+		}
+		column := sqlColumn{
+			Name:    lo.SnakeCase(field.FieldName),
+			Type:    sqlColumnType(tableName, field),
+			NotNull: !field.Nullable || field.Primary,
+			Default: sqlDefault(field),
+			Unique:  field.Unique && !field.Primary,
+		}
+		if field.Primary {
+			column.Identity = entity.HasIntegerPrimaryKey()
+		}
+		if field.IsEnum() && field.EnumConstraint == "check" {
+			column.Check = fmt.Sprintf("%s IN (%s)", quoteIdent(column.Name), sqlStringList(field.Values))
+		}
+		if field.Primary {
+			table.PrimaryKey = append(table.PrimaryKey, column.Name)
+		}
+		table.Columns = append(table.Columns, column)
+	}
+
+	for _, relation := range entity.Relations {
+		related, ok := byName[relation.RelatedEntity]
+		if !ownsForeignKey(relation) || !ok {
+			continue
+		}
+		// A junction entity declares its foreign keys as key fields
+		column := foreignKeyColumn(relation.FieldName)
+		if _, exists := findColumn(table, column); !exists {
+			table.Columns = append(table.Columns, sqlColumn{Name: column, Type: primaryKeyColumnType(related)})
+		}
+		table.ForeignKeys = append(table.ForeignKeys, referenceTo(tableName, column, related))
+	}
+
+	table.Columns = append(table.Columns,
+		sqlColumn{Name: "created_at", Type: "timestamptz"},
+		sqlColumn{Name: "updated_at", Type: "timestamptz"})
+	if entity.AdditionalFeatures.SoftDelete {
+		table.Columns = append(table.Columns, sqlColumn{Name: "deleted_at", Type: "timestamptz"})
+		table.Indexes = append(table.Indexes, sqlIndex{Name: fmt.Sprintf("idx_%s_deleted_at", tableName), Column: "deleted_at"})
+	}
+	return table
+}
+
+// joinTable mirrors the join table gorm creates for a many2many field: one
+// column per side named after the entity and its primary key, e.g. course_id
+func joinTable(name string, entity, related Entity, relation Relation) sqlTable {
+	ownerColumn := lo.SnakeCase(entity.EntityName + toGoFieldName(entity.GetPrimaryKeyName()))
+	relatedColumn := lo.SnakeCase(related.EntityName + toGoFieldName(related.GetPrimaryKeyName()))
+	if entity.EntityName == related.EntityName {
+		// gorm names the other side of a self reference after the field instead
+		relatedColumn = lo.SnakeCase(inflection.Singular(toGoFieldName(relation.FieldName)) + toGoFieldName(related.GetPrimaryKeyName()))
+	}
+
+	table := sqlTable{
+		Name: name,
+		Columns: []sqlColumn{
+			{Name: ownerColumn, Type: primaryKeyColumnType(entity), NotNull: true},
+			{Name: relatedColumn, Type: primaryKeyColumnType(related), NotNull: true},
+		},
+		PrimaryKey: []string{ownerColumn, relatedColumn},
+		ForeignKeys: []sqlForeignKey{
+			referenceTo(name, ownerColumn, entity),
+			referenceTo(name, relatedColumn, related),
+		},
+	}
+	for i := range table.ForeignKeys {
+		table.ForeignKeys[i].OnDelete, table.ForeignKeys[i].OnUpdate = "CASCADE", "CASCADE"
+	}
+	return table
+}
+
+// referenceTo builds the foreign key of column in table to the primary key of entity
+func referenceTo(table, column string, entity Entity) sqlForeignKey {
+	return sqlForeignKey{
+		Name:      foreignKeyName(table, column),
+		Column:    column,
+		RefTable:  entity.GetTableName(),
+		RefColumn: lo.SnakeCase(entity.GetPrimaryKeyName()),
+	}
+}
+
+// sqlColumnType is the Postgres type of a field's column, the type gorm picks
+// for its Go type unless the gorm tags set one
+func sqlColumnType(tableName string, field Field) string {
+	if field.Primary {
+		switch primaryKeyKind(field) {
+		case keyUUID:
+			return "char(36)"
+		case keyULID:
+			return "char(26)"
+		default:
+			return "bigint"
+		}
+	}
+	if field.IsEnum() && field.EnumConstraint == "native" {
+		return enumSQLType(tableName, field)
+	}
+	switch convertTypeScriptTypeToGo(field.FieldType) {
+	case "int", "int64", "uint":
+		return "bigint"
+	case "float64":
+		return "decimal"
+	case "bool":
+		return "boolean"
+	case "time.Time":
+		return "timestamptz"
+	case "datatypes.JSON":
+		return "jsonb"
+	default:
+		return "text"
+	}
+}
+
+func primaryKeyColumnType(entity Entity) string {
+	return sqlColumnType(entity.GetTableName(), entity.GetPrimaryKey())
+}
+
+// sqlDefault renders the default of a field as an SQL expression, quoting it
+// unless the column is numeric or boolean
+func sqlDefault(field Field) string {
+	if field.Default == nil || field.Default == "" || field.Primary {
+		return ""
+	}
+	switch value := field.Default.(type) {
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(value))
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case int, int64, uint64:
+		return fmt.Sprint(value)
+	case string:
+		switch convertTypeScriptTypeToGo(field.FieldType) {
+		case "int", "int64", "uint", "float64", "bool":
+			return value
+		}
+		return sqlStringList([]string{value})
+	}
+	encoded, err := json.Marshal(field.Default)
+	if err != nil {
+		return ""
+	}
+	return sqlStringList([]string{string(encoded)})
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdents(names []string) string {
+	return strings.Join(lo.Map(names, func(name string, _ int) string { return quoteIdent(name) }), ", ")
+}
+
+func columnSQL(column sqlColumn) string {
+	definition := quoteIdent(column.Name) + " " + column.Type
+	if column.NotNull {
+		definition += " NOT NULL"
+	}
+	if column.Default != "" {
+		definition += " DEFAULT " + column.Default
+	}
+	if column.Identity {
+		definition += " GENERATED BY DEFAULT AS IDENTITY"
+	}
+	return definition
+}
+
+func primaryKeyName(table string) string {
+	return table + "_pkey"
+}
+
+func foreignKeyName(table, column string) string {
+	return fmt.Sprintf("fk_%s_%s", table, column)
+}
+
+func uniqueConstraintName(table, column string) string {
+	return fmt.Sprintf("uni_%s_%s", table, column)
+}
+
+// checkConstraintName matches the name formatGormTags gives enum checks
+func checkConstraintName(table, column string) string {
+	return fmt.Sprintf("chk_%s_%s", table, column)
+}
+
+func primaryKeySQL(table sqlTable) string {
+	return fmt.Sprintf("CONSTRAINT %s PRIMARY KEY (%s)", quoteIdent(primaryKeyName(table.Name)), quoteIdents(table.PrimaryKey))
+}
+
+func uniqueSQL(table string, column sqlColumn) string {
+	return fmt.Sprintf("CONSTRAINT %s UNIQUE (%s)", quoteIdent(uniqueConstraintName(table, column.Name)), quoteIdent(column.Name))
+}
+
+func checkSQL(table string, column sqlColumn) string {
+	return fmt.Sprintf("CONSTRAINT %s CHECK (%s)", quoteIdent(checkConstraintName(table, column.Name)), column.Check)
+}
+
+func foreignKeySQL(fk sqlForeignKey) string {
+	definition := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		quoteIdent(fk.Name), quoteIdent(fk.Column), quoteIdent(fk.RefTable), quoteIdent(fk.RefColumn))
+	if fk.OnDelete != "" {
+		definition += " ON DELETE " + fk.OnDelete
+	}
+	if fk.OnUpdate != "" {
+		definition += " ON UPDATE " + fk.OnUpdate
+	}
+	return definition
+}
+
+func createIndexSQL(table string, index sqlIndex) string {
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s);", quoteIdent(index.Name), quoteIdent(table), quoteIdent(index.Column))
+}
+
+func alterTableSQL(table, action string) string {
+	return fmt.Sprintf("ALTER TABLE %s %s;", quoteIdent(table), action)
+}
+
+func createEnumTypeSQL(enum sqlEnumType) string {
+	return fmt.Sprintf("CREATE TYPE %s AS ENUM (%s);", enum.Name, sqlStringList(enum.Values))
+}
+
+// createTableSQL creates table with its constraints. Foreign keys to tables
+// missing from created are left out and returned, to be added later.
+func createTableSQL(table sqlTable, created map[string]bool) (string, []sqlForeignKey) {
+	var definitions []string
+	for _, column := range table.Columns {
+		definitions = append(definitions, columnSQL(column))
+	}
+	if len(table.PrimaryKey) > 0 {
+		definitions = append(definitions, primaryKeySQL(table))
+	}
+	for _, column := range table.Columns {
+		if column.Unique {
+			definitions = append(definitions, uniqueSQL(table.Name, column))
+		}
+		if column.Check != "" {
+			definitions = append(definitions, checkSQL(table.Name, column))
+		}
+	}
+	var deferred []sqlForeignKey
+	for _, fk := range table.ForeignKeys {
+		if !created[fk.RefTable] && fk.RefTable != table.Name {
+			deferred = append(deferred, fk)
+			continue
+		}
+		definitions = append(definitions, foreignKeySQL(fk))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n    %s\n);", quoteIdent(table.Name), strings.Join(definitions, ",\n    ")), deferred
+}
+
+// renderCreateSchema returns the migration creating schema from scratch and
+// the one dropping it again
+func renderCreateSchema(schema sqlSchema) (up, down string) {
+	var upStatements, downStatements []string
+	for _, enum := range schema.EnumTypes {
+		upStatements = append(upStatements, createEnumTypeSQL(enum))
+	}
+
+	type deferredKey struct {
+		table string
+		fk    sqlForeignKey
+	}
+	var deferred []deferredKey
+	created := make(map[string]bool)
+	for _, table := range schema.Tables {
+		statement, later := createTableSQL(table, created)
+		created[table.Name] = true
+		upStatements = append(upStatements, statement)
+		for _, index := range table.Indexes {
+			upStatements = append(upStatements, createIndexSQL(table.Name, index))
+		}
+		for _, fk := range later {
+			deferred = append(deferred, deferredKey{table.Name, fk})
+		}
+	}
+	for _, key := range deferred {
+		upStatements = append(upStatements, alterTableSQL(key.table, "ADD "+foreignKeySQL(key.fk)))
+		downStatements = append(downStatements, alterTableSQL(key.table, "DROP CONSTRAINT IF EXISTS "+quoteIdent(key.fk.Name)))
+	}
+
+	for i := len(schema.Tables) - 1; i >= 0; i-- {
+		downStatements = append(downStatements, fmt.Sprintf("DROP TABLE IF EXISTS %s;", quoteIdent(schema.Tables[i].Name)))
+	}
+	for i := len(schema.EnumTypes) - 1; i >= 0; i-- {
+		downStatements = append(downStatements, fmt.Sprintf("DROP TYPE IF EXISTS %s;", schema.EnumTypes[i].Name))
+	}
+	return joinStatements(upStatements), joinStatements(downStatements)
+}
+
+func joinStatements(statements []string) string {
+	if len(statements) == 0 {
+		return ""
+	}
+	return strings.Join(statements, "\n\n") + "\n"
+}
+
+// snapshotName is the file in the migrations directory recording the schema
+// the migrations lead to, which migrate diff compares the current schema with
+const snapshotName = ".crudgen-schema.json"
+
+const snapshotVersion = 1
+
+type schemaSnapshot struct {
+	Version int `json:"version"`
+	// Migration is the version of the last migration written with the snapshot
+	Migration int       `json:"migration"`
+	Schema    sqlSchema `json:"schema"`
+}
+
+// loadSnapshot reads the snapshot of the migrations in dir, nil when there is none
+func loadSnapshot(dir string) (*schemaSnapshot, error) {
+	data, err := os.ReadFile(filepath.Join(dir, snapshotName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", snapshotName, err)
+	}
+
+	var snapshot schemaSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", snapshotName, err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("%s has version %d, expected %d", snapshotName, snapshot.Version, snapshotVersion)
+	}
+	return &snapshot, nil
+}
+
+func (snapshot *schemaSnapshot) save(dir string) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, snapshotName), append(data, '\n'), 0644)
+}
+
+// Migration file layouts
+const (
+	// formatGolangMigrate writes 000001_name.up.sql and 000001_name.down.sql
+	formatGolangMigrate = "golang-migrate"
+	// formatGoose writes 00001_name.sql with annotated up and down sections
+	formatGoose = "goose"
+)
+
+var migrationFormats = []string{formatGolangMigrate, formatGoose}
+
+// migrationFiles lays a migration out as files of the given format, keyed by
+// file name
+func migrationFiles(format string, version int, name, up, down string) map[string]string {
+	if format == formatGoose {
+		return map[string]string{
+			fmt.Sprintf("%05d_%s.sql", version, name): "-- +goose Up\n" + up + "\n-- +goose Down\n" + down,
+		}
+	}
+	base := fmt.Sprintf("%06d_%s", version, name)
+	return map[string]string{base + ".up.sql": up, base + ".down.sql": down}
+}
+
+// latestMigrationVersion returns the highest version among the migrations in
+// dir, 0 when there are none
+func latestMigrationVersion(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	latest := 0
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if entry.IsDir() || !ok || filepath.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		if version, err := strconv.Atoi(prefix); err == nil && version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// writeMigration writes the files of a migration and the snapshot of the schema
+// it leads to into dir, or prints the files on a dry run
+func writeMigration(dir string, files map[string]string, snapshot *schemaSnapshot, dryRun, quiet bool) error {
+	names := lo.Keys(files)
+	sort.Strings(names)
+	if dryRun {
+		for _, name := range names {
+			fmt.Printf("-- %s\n%s\n", filepath.Join(dir, name), files[name])
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating directory %s: %v", dir, err)
+	}
+	for _, name := range names {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(files[name]), 0644); err != nil {
+			return fmt.Errorf("error writing %s: %v", file, err)
+		}
+		if !quiet {
+			fmt.Printf("Wrote %s\n", file)
+		}
+	}
+	if err := snapshot.save(dir); err != nil {
+		return fmt.Errorf("error writing %s: %v", snapshotName, err)
+	}
+	return nil
+}
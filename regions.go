@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Generated regions are the parts of user owned files that the generator keeps
+// up to date. They are delimited by marker comments on their own lines:
+//
+//	// crudgen:begin routes
+//	...
+//	// crudgen:end routes
+//
+// Everything between the markers is replaced on every run, everything outside
+// them belongs to the user.
+const (
+	regionBegin = "// crudgen:begin "
+	regionEnd   = "// crudgen:end "
+)
+
+// region locates a generated region by the lines of its markers
+type region struct {
+	name       string
+	begin, end int // lines of the begin and end markers
+}
+
+// findRegions locates every generated region in lines, in order
+func findRegions(lines []string) ([]region, error) {
+	var regions []region
+	var open *region
+	seen := make(map[string]bool)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if name, ok := strings.CutPrefix(trimmed, regionBegin); ok {
+			if open != nil {
+				return nil, fmt.Errorf("line %d: region %q begins inside region %q", i+1, name, open.name)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("line %d: region %q appears twice", i+1, name)
+			}
+			seen[name] = true
+			open = &region{name: name, begin: i}
+		} else if name, ok := strings.CutPrefix(trimmed, regionEnd); ok {
+			if open == nil || open.name != name {
+				return nil, fmt.Errorf("line %d: end of region %q without its begin marker", i+1, name)
+			}
+			open.end = i
+			regions = append(regions, *open)
+			open = nil
+		}
+	}
+	if open != nil {
+		return nil, fmt.Errorf("line %d: region %q is never closed", open.begin+1, open.name)
+	}
+	return regions, nil
+}
+
+// mergeRegions copies the generated regions of rendered into existing and leaves
+// the rest of existing untouched. Regions the existing file doesn't have are
+// returned as missing; they are not added, since there's no telling where the
+// user would want them.
+func mergeRegions(existing, rendered []byte) (merged []byte, missing []string, err error) {
+	renderedLines := strings.Split(string(rendered), "\n")
+	generated, err := findRegions(renderedLines)
+	if err != nil {
+		return nil, nil, fmt.Errorf("template: %v", err)
+	}
+
+	existingLines := strings.Split(string(existing), "\n")
+	current, err := findRegions(existingLines)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bodies := make(map[string][]string)
+	for _, r := range generated {
+		bodies[r.name] = renderedLines[r.begin+1 : r.end]
+	}
+
+	var out []string
+	next := 0
+	for _, r := range current {
+		body, ok := bodies[r.name]
+		if !ok {
+			// The template dropped this region; keep what the user has
+			continue
+		}
+		out = append(out, existingLines[next:r.begin+1]...)
+		out = append(out, body...)
+		next = r.end
+		delete(bodies, r.name)
+	}
+	out = append(out, existingLines[next:]...)
+
+	for _, r := range generated {
+		if _, ok := bodies[r.name]; ok {
+			missing = append(missing, r.name)
+		}
+	}
+	return []byte(strings.Join(out, "\n")), missing, nil
+}
+
+// hasRegions reports whether src contains any generated region marker
+func hasRegions(src []byte) bool {
+	return bytes.Contains(src, []byte(regionBegin))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func joinLines(l ...string) string {
+	return strings.Join(l, "\n")
+}
+
+func TestMergeRegions(t *testing.T) {
+	rendered := joinLines(
+		"package controllers",
+		"// crudgen:begin imports",
+		`import "new"`,
+		"// crudgen:end imports",
+		"func routes() {",
+		"	// crudgen:begin routes",
+		"	new()",
+		"	newer()",
+		"	// crudgen:end routes",
+		"}",
+	)
+
+	tests := []struct {
+		name     string
+		existing string
+		rendered string
+		want     string
+		missing  []string
+		err      string
+	}{
+		{
+			name: "replaces the regions and keeps the rest",
+			existing: joinLines(
+				"package controllers",
+				"// crudgen:begin imports",
+				`import "old"`,
+				"// crudgen:end imports",
+				"",
+				"// user code",
+				"func routes() {",
+				"	custom()",
+				"	// crudgen:begin routes",
+				"	old()",
+				"	// crudgen:end routes",
+				"	more()",
+				"}",
+			),
+			rendered: rendered,
+			want: joinLines(
+				"package controllers",
+				"// crudgen:begin imports",
+				`import "new"`,
+				"// crudgen:end imports",
+				"",
+				"// user code",
+				"func routes() {",
+				"	custom()",
+				"	// crudgen:begin routes",
+				"	new()",
+				"	newer()",
+				"	// crudgen:end routes",
+				"	more()",
+				"}",
+			),
+		},
+		{
+			name:     "region missing from the file",
+			existing: joinLines("package controllers", "// crudgen:begin routes", "old()", "// crudgen:end routes"),
+			rendered: rendered,
+			want:     joinLines("package controllers", "// crudgen:begin routes", "	new()", "	newer()", "// crudgen:end routes"),
+			missing:  []string{"imports"},
+		},
+		{
+			name:     "file without markers",
+			existing: joinLines("package controllers", "func routes() {}"),
+			rendered: rendered,
+			want:     joinLines("package controllers", "func routes() {}"),
+			missing:  []string{"imports", "routes"},
+		},
+		{
+			name:     "region dropped by the template is kept",
+			existing: joinLines("// crudgen:begin legacy", "legacy()", "// crudgen:end legacy", "// crudgen:begin routes", "old()", "// crudgen:end routes"),
+			rendered: joinLines("// crudgen:begin routes", "new()", "// crudgen:end routes"),
+			want:     joinLines("// crudgen:begin legacy", "legacy()", "// crudgen:end legacy", "// crudgen:begin routes", "new()", "// crudgen:end routes"),
+		},
+		{
+			name:     "empty region",
+			existing: joinLines("// crudgen:begin routes", "// crudgen:end routes"),
+			rendered: joinLines("// crudgen:begin routes", "new()", "// crudgen:end routes"),
+			want:     joinLines("// crudgen:begin routes", "new()", "// crudgen:end routes"),
+		},
+		{
+			name:     "duplicated region",
+			existing: joinLines("// crudgen:begin routes", "// crudgen:end routes", "// crudgen:begin routes", "// crudgen:end routes"),
+			rendered: rendered,
+			err:      `line 3: region "routes" appears twice`,
+		},
+		{
+			name:     "unclosed region",
+			existing: joinLines("package controllers", "// crudgen:begin routes", "old()"),
+			rendered: rendered,
+			err:      `line 2: region "routes" is never closed`,
+		},
+		{
+			name:     "end marker without begin",
+			existing: joinLines("old()", "// crudgen:end routes"),
+			rendered: rendered,
+			err:      `line 2: end of region "routes" without its begin marker`,
+		},
+		{
+			name:     "mismatched end marker",
+			existing: joinLines("// crudgen:begin routes", "// crudgen:end imports"),
+			rendered: rendered,
+			err:      `line 2: end of region "imports" without its begin marker`,
+		},
+		{
+			name:     "nested region",
+			existing: joinLines("// crudgen:begin routes", "// crudgen:begin imports", "// crudgen:end imports", "// crudgen:end routes"),
+			rendered: rendered,
+			err:      `line 2: region "imports" begins inside region "routes"`,
+		},
+		{
+			name:     "broken template",
+			existing: joinLines("// crudgen:begin routes", "// crudgen:end routes"),
+			rendered: joinLines("// crudgen:begin routes"),
+			err:      `template: line 1: region "routes" is never closed`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, missing, err := mergeRegions([]byte(tt.existing), []byte(tt.rendered))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(merged) != tt.want {
+				t.Errorf("merged:\n%s\nwant:\n%s", merged, tt.want)
+			}
+			if !reflect.DeepEqual(missing, tt.missing) {
+				t.Errorf("missing %q, want %q", missing, tt.missing)
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// schemaDiff is the migration from one sqlSchema to another
+type schemaDiff struct {
+	statements []string
+	// destructive describes the statements that drop data or may fail on
+	// existing rows. They are also marked with a comment in the SQL.
+	destructive []string
+}
+
+func (d *schemaDiff) add(statements ...string) {
+	d.statements = append(d.statements, statements...)
+}
+
+func (d *schemaDiff) addDestructive(reason, statement string) {
+	d.destructive = append(d.destructive, reason)
+	d.statements = append(d.statements, "-- DESTRUCTIVE: "+reason+"\n"+statement)
+}
+
+// diffSchemas returns the statements migrating a database from one schema to
+// the other. Dropping comes before creating so that names can be reused, and
+// tables and columns exist before the constraints that refer to them.
+// Swapping the arguments gives the reverse migration.
+func diffSchemas(from, to sqlSchema) schemaDiff {
+	var d schemaDiff
+	from = cloneSchema(from)
+	d.renameTables(&from, to)
+
+	fromTables := lo.KeyBy(from.Tables, func(table sqlTable) string { return table.Name })
+	toTables := lo.KeyBy(to.Tables, func(table sqlTable) string { return table.Name })
+	fromEnums := lo.KeyBy(from.EnumTypes, func(enum sqlEnumType) string { return enum.Name })
+	toEnums := lo.KeyBy(to.EnumTypes, func(enum sqlEnumType) string { return enum.Name })
+	// kept pairs the tables present in both schemas, in the order of to
+	type keptTable struct{ from, to sqlTable }
+	var kept []keptTable
+	for _, table := range to.Tables {
+		if old, ok := fromTables[table.Name]; ok {
+			kept = append(kept, keptTable{old, table})
+		}
+	}
+	// retyped reports whether a foreign key refers to a column whose type
+	// changes. Postgres refuses to change the type under the constraint, so it
+	// is dropped first and added again afterwards.
+	retyped := func(fk sqlForeignKey) bool {
+		before, _ := findColumn(fromTables[fk.RefTable], fk.RefColumn)
+		after, _ := findColumn(toTables[fk.RefTable], fk.RefColumn)
+		return before.Type != after.Type
+	}
+
+	for _, enum := range to.EnumTypes {
+		old, ok := fromEnums[enum.Name]
+		switch {
+		case !ok:
+			d.add(createEnumTypeSQL(enum))
+		case slices.Equal(old.Values, enum.Values):
+		case slices.Equal(old.Values, enum.Values[:min(len(old.Values), len(enum.Values))]):
+			for _, value := range enum.Values[len(old.Values):] {
+				d.add(fmt.Sprintf("ALTER TYPE %s ADD VALUE %s;", enum.Name, sqlStringList([]string{value})))
+			}
+		default:
+			statement := recreateEnumTypeSQL(enum, from)
+			if removed := lo.Without(old.Values, enum.Values...); len(removed) > 0 {
+				d.addDestructive(fmt.Sprintf("enum type %s drops the values %s, rows holding them fail the conversion", enum.Name, strings.Join(removed, ", ")), statement)
+			} else {
+				d.add(statement)
+			}
+		}
+	}
+
+	// Constraints that go away or change
+	for _, pair := range kept {
+		for _, fk := range pair.from.ForeignKeys {
+			if !slices.Contains(pair.to.ForeignKeys, fk) || retyped(fk) {
+				d.add(alterTableSQL(pair.to.Name, "DROP CONSTRAINT IF EXISTS "+quoteIdent(fk.Name)))
+			}
+		}
+		for _, index := range pair.from.Indexes {
+			if !slices.Contains(pair.to.Indexes, index) {
+				d.add(fmt.Sprintf("DROP INDEX IF EXISTS %s;", quoteIdent(index.Name)))
+			}
+		}
+		if len(pair.from.PrimaryKey) > 0 && !slices.Equal(pair.from.PrimaryKey, pair.to.PrimaryKey) {
+			d.add(alterTableSQL(pair.to.Name, "DROP CONSTRAINT IF EXISTS "+quoteIdent(primaryKeyName(pair.to.Name))))
+		}
+		for _, column := range pair.from.Columns {
+			next, _ := findColumn(pair.to, column.Name)
+			if column.Unique && !next.Unique {
+				d.add(alterTableSQL(pair.to.Name, "DROP CONSTRAINT IF EXISTS "+quoteIdent(uniqueConstraintName(pair.to.Name, column.Name))))
+			}
+			if column.Check != "" && column.Check != next.Check {
+				d.add(alterTableSQL(pair.to.Name, "DROP CONSTRAINT IF EXISTS "+quoteIdent(checkConstraintName(pair.to.Name, column.Name))))
+			}
+		}
+	}
+
+	// Dropped tables go in reverse creation order. Foreign keys pointing to a
+	// table created later, which only happens in cycles, go first.
+	for i := len(from.Tables) - 1; i >= 0; i-- {
+		table := from.Tables[i]
+		if _, ok := toTables[table.Name]; ok {
+			continue
+		}
+		for _, fk := range table.ForeignKeys {
+			_, referencedKept := toTables[fk.RefTable]
+			if !referencedKept && slices.ContainsFunc(from.Tables[i+1:], func(later sqlTable) bool { return later.Name == fk.RefTable }) {
+				d.add(alterTableSQL(table.Name, "DROP CONSTRAINT IF EXISTS "+quoteIdent(fk.Name)))
+			}
+		}
+	}
+	for i := len(from.Tables) - 1; i >= 0; i-- {
+		table := from.Tables[i]
+		if _, ok := toTables[table.Name]; !ok {
+			d.addDestructive(fmt.Sprintf("drops table %s and its data", table.Name), fmt.Sprintf("DROP TABLE IF EXISTS %s;", quoteIdent(table.Name)))
+		}
+	}
+
+	// New tables, with the foreign keys to tables that don't exist yet added
+	// once they do
+	type deferredKey struct {
+		table string
+		fk    sqlForeignKey
+	}
+	var deferred []deferredKey
+	existing := make(map[string]bool)
+	for _, pair := range kept {
+		existing[pair.to.Name] = true
+	}
+	for _, table := range to.Tables {
+		if _, ok := fromTables[table.Name]; ok {
+			continue
+		}
+		statement, later := createTableSQL(table, existing)
+		existing[table.Name] = true
+		d.add(statement)
+		for _, index := range table.Indexes {
+			d.add(createIndexSQL(table.Name, index))
+		}
+		for _, fk := range later {
+			deferred = append(deferred, deferredKey{table.Name, fk})
+		}
+	}
+
+	for _, pair := range kept {
+		d.alterColumns(pair.from, pair.to)
+	}
+
+	// Constraints that are new or changed
+	for _, pair := range kept {
+		if len(pair.to.PrimaryKey) > 0 && !slices.Equal(pair.from.PrimaryKey, pair.to.PrimaryKey) {
+			d.add(alterTableSQL(pair.to.Name, "ADD "+primaryKeySQL(pair.to)))
+		}
+		for _, column := range pair.to.Columns {
+			// Constraints on a column that already holds data may fail
+			previous, existed := findColumn(pair.from, column.Name)
+			if column.Unique && !previous.Unique {
+				statement := alterTableSQL(pair.to.Name, "ADD "+uniqueSQL(pair.to.Name, column))
+				if existed {
+					d.addDestructive(fmt.Sprintf("adds a unique constraint on %s.%s, which fails if existing rows repeat a value", pair.to.Name, column.Name), statement)
+				} else {
+					d.add(statement)
+				}
+			}
+			if column.Check != "" && column.Check != previous.Check {
+				statement := alterTableSQL(pair.to.Name, "ADD "+checkSQL(pair.to.Name, column))
+				if existed {
+					d.addDestructive(fmt.Sprintf("adds a check constraint on %s.%s, which fails if existing rows violate it", pair.to.Name, column.Name), statement)
+				} else {
+					d.add(statement)
+				}
+			}
+		}
+		for _, fk := range pair.to.ForeignKeys {
+			if !slices.Contains(pair.from.ForeignKeys, fk) || retyped(fk) {
+				d.add(alterTableSQL(pair.to.Name, "ADD "+foreignKeySQL(fk)))
+			}
+		}
+		for _, index := range pair.to.Indexes {
+			if !slices.Contains(pair.from.Indexes, index) {
+				d.add(createIndexSQL(pair.to.Name, index))
+			}
+		}
+	}
+	for _, key := range deferred {
+		d.add(alterTableSQL(key.table, "ADD "+foreignKeySQL(key.fk)))
+	}
+
+	for i := len(from.EnumTypes) - 1; i >= 0; i-- {
+		if _, ok := toEnums[from.EnumTypes[i].Name]; !ok {
+			d.add(fmt.Sprintf("DROP TYPE IF EXISTS %s;", from.EnumTypes[i].Name))
+		}
+	}
+	return d
+}
+
+// alterColumns adds, drops and alters the columns of a table present in both schemas
+func (d *schemaDiff) alterColumns(from, to sqlTable) {
+	for _, column := range to.Columns {
+		previous, ok := findColumn(from, column.Name)
+		if !ok {
+			statement := alterTableSQL(to.Name, "ADD COLUMN "+columnSQL(column))
+			if column.NotNull && column.Default == "" {
+				d.addDestructive(fmt.Sprintf("adds column %s.%s as NOT NULL without a default, which fails if the table has rows", to.Name, column.Name), statement)
+			} else {
+				d.add(statement)
+			}
+			continue
+		}
+
+		alterColumn := func(action string) string {
+			return alterTableSQL(to.Name, fmt.Sprintf("ALTER COLUMN %s %s", quoteIdent(column.Name), action))
+		}
+		if previous.Identity && !column.Identity {
+			d.add(alterColumn("DROP IDENTITY IF EXISTS"))
+		}
+		if previous.Type != column.Type {
+			// The old default may not convert to the new type, so it is dropped
+			// first and set again below
+			if previous.Default != "" {
+				d.add(alterColumn("DROP DEFAULT"))
+				previous.Default = ""
+			}
+			d.addDestructive(fmt.Sprintf("changes the type of %s.%s from %s to %s, which fails or loses precision for values that don't convert", to.Name, column.Name, previous.Type, column.Type),
+				alterColumn(fmt.Sprintf("TYPE %s USING %s::%s", column.Type, quoteIdent(column.Name), column.Type)))
+		}
+		if column.NotNull && !previous.NotNull {
+			d.addDestructive(fmt.Sprintf("makes %s.%s NOT NULL, which fails if it holds nulls", to.Name, column.Name), alterColumn("SET NOT NULL"))
+		}
+		if !column.NotNull && previous.NotNull {
+			d.add(alterColumn("DROP NOT NULL"))
+		}
+		if column.Identity && !previous.Identity {
+			d.addDestructive(fmt.Sprintf("makes %s.%s an identity column, whose sequence starts at 1 and must be moved past the existing values with setval", to.Name, column.Name),
+				alterColumn("ADD GENERATED BY DEFAULT AS IDENTITY"))
+		}
+		if column.Default != previous.Default {
+			if column.Default == "" {
+				d.add(alterColumn("DROP DEFAULT"))
+			} else {
+				d.add(alterColumn("SET DEFAULT " + column.Default))
+			}
+		}
+	}
+
+	for _, column := range from.Columns {
+		if _, ok := findColumn(to, column.Name); !ok {
+			d.addDestructive(fmt.Sprintf("drops column %s.%s and its data", to.Name, column.Name), alterTableSQL(to.Name, "DROP COLUMN IF EXISTS "+quoteIdent(column.Name)))
+		}
+	}
+}
+
+// renameTables renames the tables of from whose entity has another table name
+// in to, along with the constraints, indexes and enum types named after them,
+// and updates from to match
+func (d *schemaDiff) renameTables(from *sqlSchema, to sqlSchema) {
+	for i := range from.Tables {
+		table := &from.Tables[i]
+		target, ok := lo.Find(to.Tables, func(t sqlTable) bool { return t.Entity != "" && t.Entity == table.Entity })
+		if table.Entity == "" || !ok || target.Name == table.Name ||
+			slices.ContainsFunc(from.Tables, func(t sqlTable) bool { return t.Name == target.Name }) {
+			continue
+		}
+
+		oldName, newName := table.Name, target.Name
+		d.add(alterTableSQL(oldName, "RENAME TO "+quoteIdent(newName)))
+		table.Name = newName
+		renameConstraint := func(oldConstraint, newConstraint string) {
+			d.add(alterTableSQL(newName, fmt.Sprintf("RENAME CONSTRAINT %s TO %s", quoteIdent(oldConstraint), quoteIdent(newConstraint))))
+		}
+
+		if len(table.PrimaryKey) > 0 {
+			renameConstraint(primaryKeyName(oldName), primaryKeyName(newName))
+		}
+		for j := range table.Columns {
+			column := &table.Columns[j]
+			if column.Unique {
+				renameConstraint(uniqueConstraintName(oldName, column.Name), uniqueConstraintName(newName, column.Name))
+			}
+			if column.Check != "" {
+				renameConstraint(checkConstraintName(oldName, column.Name), checkConstraintName(newName, column.Name))
+			}
+			// Native enum types are named after their table
+			oldType, newType := oldName+"_"+column.Name, newName+"_"+column.Name
+			if k := slices.IndexFunc(from.EnumTypes, func(enum sqlEnumType) bool { return enum.Name == oldType }); k >= 0 && column.Type == oldType {
+				d.add(fmt.Sprintf("ALTER TYPE %s RENAME TO %s;", oldType, newType))
+				from.EnumTypes[k].Name = newType
+				column.Type = newType
+			}
+		}
+		for j := range table.ForeignKeys {
+			fk := &table.ForeignKeys[j]
+			if fk.Name == foreignKeyName(oldName, fk.Column) {
+				renameConstraint(fk.Name, foreignKeyName(newName, fk.Column))
+				fk.Name = foreignKeyName(newName, fk.Column)
+			}
+		}
+		for j := range table.Indexes {
+			index := &table.Indexes[j]
+			if suffix, ok := strings.CutPrefix(index.Name, "idx_"+oldName+"_"); ok {
+				d.add(fmt.Sprintf("ALTER INDEX %s RENAME TO %s;", quoteIdent(index.Name), quoteIdent("idx_"+newName+"_"+suffix)))
+				index.Name = "idx_" + newName + "_" + suffix
+			}
+		}
+
+		// Foreign keys follow the table they reference
+		for k := range from.Tables {
+			for l := range from.Tables[k].ForeignKeys {
+				if from.Tables[k].ForeignKeys[l].RefTable == oldName {
+					from.Tables[k].ForeignKeys[l].RefTable = newName
+				}
+			}
+		}
+	}
+}
+
+// recreateEnumTypeSQL replaces a native enum type whose values can't simply be
+// appended to, converting the columns of schema that use it
+func recreateEnumTypeSQL(enum sqlEnumType, schema sqlSchema) string {
+	previous := enum.Name + "_old"
+	statements := []string{
+		fmt.Sprintf("ALTER TYPE %s RENAME TO %s;", enum.Name, previous),
+		createEnumTypeSQL(enum),
+	}
+	for _, table := range schema.Tables {
+		for _, column := range table.Columns {
+			if column.Type != enum.Name {
+				continue
+			}
+			alterColumn := func(action string) string {
+				return alterTableSQL(table.Name, fmt.Sprintf("ALTER COLUMN %s %s", quoteIdent(column.Name), action))
+			}
+			if column.Default != "" {
+				statements = append(statements, alterColumn("DROP DEFAULT"))
+			}
+			statements = append(statements, alterColumn(fmt.Sprintf("TYPE %s USING %s::text::%s", enum.Name, quoteIdent(column.Name), enum.Name)))
+			if column.Default != "" {
+				statements = append(statements, alterColumn("SET DEFAULT "+column.Default))
+			}
+		}
+	}
+	statements = append(statements, fmt.Sprintf("DROP TYPE %s;", previous))
+	return strings.Join(statements, "\n")
+}
+
+func findColumn(table sqlTable, name string) (sqlColumn, bool) {
+	return lo.Find(table.Columns, func(column sqlColumn) bool { return column.Name == name })
+}
+
+func cloneSchema(schema sqlSchema) sqlSchema {
+	var clone sqlSchema
+	data, err := json.Marshal(schema)
+	if err == nil {
+		err = json.Unmarshal(data, &clone)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("cloning schema: %v", err))
+	}
+	return clone
+}
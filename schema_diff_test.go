@@ -0,0 +1,210 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testSchema builds the SQL schema of the entities defined by input
+func testSchema(t *testing.T, input string) sqlSchema {
+	t.Helper()
+	entities := parseTestInput(t, "schema.json", input)
+	AssignRelations(entities)
+	return buildSQLSchema(entities)
+}
+
+func TestDiffSchemas(t *testing.T) {
+	course := `[{"entityName": "Course", "fields": [
+		{"fieldName": "id", "fieldType": "uuid", "primary": true},
+		{"fieldName": "title", "fieldType": "string"},
+		{"fieldName": "code", "fieldType": "string", "nullable": true}
+	]}]`
+	school := `[
+		{"entityName": "Course", "fields": [
+			{"fieldName": "id", "fieldType": "uuid", "primary": true},
+			{"fieldName": "level", "fieldType": "enum", "values": ["a", "b", "c"], "enumConstraint": "native"}
+		], "relations": [{"relationType": "ManyToOne", "relatedEntity": "Teacher", "fieldName": "teacher"}]},
+		{"entityName": "Teacher", "fields": [{"fieldName": "id", "fieldType": "uuid", "primary": true}],
+		 "relations": [{"relationType": "OneToMany", "relatedEntity": "Course", "fieldName": "courses"}]}
+	]`
+
+	tests := []struct {
+		name        string
+		from, to    string
+		statements  []string
+		destructive []string
+	}{
+		{
+			name: "unchanged",
+			from: school,
+			to:   school,
+		},
+		{
+			name: "renamed table",
+			from: course,
+			to: `[{"entityName": "Course", "tableName": "classes", "fields": [
+				{"fieldName": "id", "fieldType": "uuid", "primary": true},
+				{"fieldName": "title", "fieldType": "string"},
+				{"fieldName": "code", "fieldType": "string", "nullable": true}
+			]}]`,
+			statements: []string{
+				`ALTER TABLE "courses" RENAME TO "classes";`,
+				`ALTER TABLE "classes" RENAME CONSTRAINT "courses_pkey" TO "classes_pkey";`,
+			},
+		},
+		{
+			name: "renamed referenced table keeps the foreign key",
+			from: school,
+			to: `[
+				{"entityName": "Course", "fields": [
+					{"fieldName": "id", "fieldType": "uuid", "primary": true},
+					{"fieldName": "level", "fieldType": "enum", "values": ["a", "b", "c"], "enumConstraint": "native"}
+				], "relations": [{"relationType": "ManyToOne", "relatedEntity": "Teacher", "fieldName": "teacher"}]},
+				{"entityName": "Teacher", "tableName": "staff", "fields": [{"fieldName": "id", "fieldType": "uuid", "primary": true}],
+				 "relations": [{"relationType": "OneToMany", "relatedEntity": "Course", "fieldName": "courses"}]}
+			]`,
+			statements: []string{
+				`ALTER TABLE "teachers" RENAME TO "staff";`,
+				`ALTER TABLE "staff" RENAME CONSTRAINT "teachers_pkey" TO "staff_pkey";`,
+			},
+		},
+		{
+			name: "renamed table with a unique column",
+			from: `[{"entityName": "Course", "tableName": "classes", "fields": [
+				{"fieldName": "id", "fieldType": "uuid", "primary": true},
+				{"fieldName": "code", "fieldType": "string", "unique": true}
+			]}]`,
+			to: `[{"entityName": "Course", "fields": [
+				{"fieldName": "id", "fieldType": "uuid", "primary": true},
+				{"fieldName": "code", "fieldType": "string", "unique": true}
+			]}]`,
+			statements: []string{
+				`ALTER TABLE "classes" RENAME TO "courses";`,
+				`ALTER TABLE "courses" RENAME CONSTRAINT "classes_pkey" TO "courses_pkey";`,
+				`ALTER TABLE "courses" RENAME CONSTRAINT "uni_classes_code" TO "uni_courses_code";`,
+			},
+		},
+		{
+			name: "nullability",
+			from: course,
+			to: `[{"entityName": "Course", "fields": [
+				{"fieldName": "id", "fieldType": "uuid", "primary": true},
+				{"fieldName": "title", "fieldType": "string", "nullable": true},
+				{"fieldName": "code", "fieldType": "string"}
+			]}]`,
+			statements: []string{
+				`ALTER TABLE "courses" ALTER COLUMN "title" DROP NOT NULL;`,
+				"-- DESTRUCTIVE: makes courses.code NOT NULL, which fails if it holds nulls\n" +
+					`ALTER TABLE "courses" ALTER COLUMN "code" SET NOT NULL;`,
+			},
+			destructive: []string{"makes courses.code NOT NULL, which fails if it holds nulls"},
+		},
+		{
+			name: "unique",
+			from: course,
+			to: `[{"entityName": "Course", "fields": [
+				{"fieldName": "id", "fieldType": "uuid", "primary": true},
+				{"fieldName": "title", "fieldType": "string", "unique": true},
+				{"fieldName": "code", "fieldType": "string", "nullable": true},
+				{"fieldName": "slug", "fieldType": "string", "nullable": true, "unique": true}
+			]}]`,
+			statements: []string{
+				`ALTER TABLE "courses" ADD COLUMN "slug" text;`,
+				"-- DESTRUCTIVE: adds a unique constraint on courses.title, which fails if existing rows repeat a value\n" +
+					`ALTER TABLE "courses" ADD CONSTRAINT "uni_courses_title" UNIQUE ("title");`,
+				`ALTER TABLE "courses" ADD CONSTRAINT "uni_courses_slug" UNIQUE ("slug");`,
+			},
+			destructive: []string{"adds a unique constraint on courses.title, which fails if existing rows repeat a value"},
+		},
+		{
+			name: "dropped unique",
+			from: `[{"entityName": "Course", "fields": [
+				{"fieldName": "id", "fieldType": "uuid", "primary": true},
+				{"fieldName": "title", "fieldType": "string", "unique": true}
+			]}]`,
+			to: `[{"entityName": "Course", "fields": [
+				{"fieldName": "id", "fieldType": "uuid", "primary": true},
+				{"fieldName": "title", "fieldType": "string"}
+			]}]`,
+			statements: []string{`ALTER TABLE "courses" DROP CONSTRAINT IF EXISTS "uni_courses_title";`},
+		},
+		{
+			name: "columns",
+			from: course,
+			to: `[{"entityName": "Course", "fields": [
+				{"fieldName": "id", "fieldType": "uuid", "primary": true},
+				{"fieldName": "title", "fieldType": "int"},
+				{"fieldName": "credits", "fieldType": "int"}
+			]}]`,
+			statements: []string{
+				"-- DESTRUCTIVE: changes the type of courses.title from text to bigint, which fails or loses precision for values that don't convert\n" +
+					`ALTER TABLE "courses" ALTER COLUMN "title" TYPE bigint USING "title"::bigint;`,
+				"-- DESTRUCTIVE: adds column courses.credits as NOT NULL without a default, which fails if the table has rows\n" +
+					`ALTER TABLE "courses" ADD COLUMN "credits" bigint NOT NULL;`,
+				"-- DESTRUCTIVE: drops column courses.code and its data\n" +
+					`ALTER TABLE "courses" DROP COLUMN IF EXISTS "code";`,
+			},
+			destructive: []string{
+				"changes the type of courses.title from text to bigint, which fails or loses precision for values that don't convert",
+				"adds column courses.credits as NOT NULL without a default, which fails if the table has rows",
+				"drops column courses.code and its data",
+			},
+		},
+		{
+			name:        "dropped table",
+			from:        course,
+			to:          `[]`,
+			statements:  []string{"-- DESTRUCTIVE: drops table courses and its data\n" + `DROP TABLE IF EXISTS "courses";`},
+			destructive: []string{"drops table courses and its data"},
+		},
+		{
+			name: "appended enum value",
+			from: school,
+			to: `[
+				{"entityName": "Course", "fields": [
+					{"fieldName": "id", "fieldType": "uuid", "primary": true},
+					{"fieldName": "level", "fieldType": "enum", "values": ["a", "b", "c", "d"], "enumConstraint": "native"}
+				], "relations": [{"relationType": "ManyToOne", "relatedEntity": "Teacher", "fieldName": "teacher"}]},
+				{"entityName": "Teacher", "fields": [{"fieldName": "id", "fieldType": "uuid", "primary": true}],
+				 "relations": [{"relationType": "OneToMany", "relatedEntity": "Course", "fieldName": "courses"}]}
+			]`,
+			statements: []string{`ALTER TYPE courses_level ADD VALUE 'd';`},
+		},
+		{
+			name: "removed enum value",
+			from: school,
+			to: `[
+				{"entityName": "Course", "fields": [
+					{"fieldName": "id", "fieldType": "uuid", "primary": true},
+					{"fieldName": "level", "fieldType": "enum", "values": ["a", "c"], "enumConstraint": "native"}
+				], "relations": [{"relationType": "ManyToOne", "relatedEntity": "Teacher", "fieldName": "teacher"}]},
+				{"entityName": "Teacher", "fields": [{"fieldName": "id", "fieldType": "uuid", "primary": true}],
+				 "relations": [{"relationType": "OneToMany", "relatedEntity": "Course", "fieldName": "courses"}]}
+			]`,
+			statements: []string{
+				"-- DESTRUCTIVE: enum type courses_level drops the values b, rows holding them fail the conversion\n" +
+					"ALTER TYPE courses_level RENAME TO courses_level_old;\n" +
+					"CREATE TYPE courses_level AS ENUM ('a', 'c');\n" +
+					`ALTER TABLE "courses" ALTER COLUMN "level" TYPE courses_level USING "level"::text::courses_level;` + "\n" +
+					"DROP TYPE courses_level_old;",
+			},
+			destructive: []string{"enum type courses_level drops the values b, rows holding them fail the conversion"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := testSchema(t, tt.from)
+			d := diffSchemas(from, testSchema(t, tt.to))
+			if !reflect.DeepEqual(d.statements, tt.statements) {
+				t.Errorf("statements:\n%q\nwant:\n%q", d.statements, tt.statements)
+			}
+			if !reflect.DeepEqual(d.destructive, tt.destructive) {
+				t.Errorf("destructive:\n%q\nwant:\n%q", d.destructive, tt.destructive)
+			}
+			if !reflect.DeepEqual(from, testSchema(t, tt.from)) {
+				t.Error("diffSchemas modified its from argument")
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// embeddedTemplates holds the default templates so the generator runs from any directory
+//
+//go:embed templates/*.tmpl
+var embeddedTemplates embed.FS
+
+// readTemplate returns the named template, preferring a file of the same name in
+// the override directory over the embedded default
+func (g *generator) readTemplate(name string) ([]byte, error) {
+	if g.templateDir != "" {
+		content, err := os.ReadFile(filepath.Join(g.templateDir, name))
+		if err == nil {
+			return content, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading template override %s: %v", name, err)
+		}
+	}
+
+	content, err := embeddedTemplates.ReadFile(path.Join("templates", name))
+	if err != nil {
+		return nil, fmt.Errorf("error reading template file %s: %v", name, err)
+	}
+	return content, nil
+}
+
+// templateOverrides lists the templates in dir that replace an embedded one, and
+// those that match none, which are most likely misspelled
+func templateOverrides(dir string) (overrides []string, unknown []string, err error) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, nil, fmt.Errorf("template directory %s does not exist", dir)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, match := range matches {
+		name := filepath.Base(match)
+		if _, err := fs.Stat(embeddedTemplates, path.Join("templates", name)); err != nil {
+			unknown = append(unknown, name)
+		} else {
+			overrides = append(overrides, name)
+		}
+	}
+	return overrides, unknown, nil
+}
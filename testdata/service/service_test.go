@@ -0,0 +1,167 @@
+// Tests run inside the service generated from schema.json by
+// TestGeneratedServiceBehaviour, against an in-memory SQLite database.
+package service_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/service/controllers"
+	"example.com/service/dto"
+	"example.com/service/models"
+	"example.com/service/repositories"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newService opens a fresh database and routes requests to the Post controller
+func newService(t *testing.T) (*gin.Engine, *repositories.PostRepository) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens another database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.Post{}); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	repository := repositories.NewPostRepository(db)
+	controllers.NewPostController(repository, router.Group(""))
+	return router, repository
+}
+
+func request(router *gin.Engine, method, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	return recorder
+}
+
+func createPosts(t *testing.T, repository *repositories.PostRepository, count int) []*models.Post {
+	t.Helper()
+	var posts []*models.Post
+	for i := 0; i < count; i++ {
+		title, level := "post", models.PostLevel("draft")
+		post, err := repository.Create(&dto.PostCreate{BasePostCreate: dto.BasePostCreate{Title: &title, Level: &level}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		posts = append(posts, post)
+	}
+	return posts
+}
+
+func TestCursorPageSize(t *testing.T) {
+	router, repository := newService(t)
+	createPosts(t, repository, repositories.DefaultPageSize+1)
+
+	for _, size := range []string{"0", "-5", "101"} {
+		if recorder := request(router, http.MethodGet, "/post?size="+size); recorder.Code != http.StatusBadRequest {
+			t.Errorf("size=%s: status %d, want %d: %s", size, recorder.Code, http.StatusBadRequest, recorder.Body)
+		}
+	}
+	if recorder := request(router, http.MethodGet, "/post?size=100"); recorder.Code != http.StatusOK {
+		t.Errorf("size=100: status %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+
+	// Callers that skip the binding get the default page size instead of a panic
+	for _, size := range []int{0, -5} {
+		posts, p, err := repository.GetAll(&dto.FullPostQuery{CursorQuery: dto.CursorQuery{Size: &size}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) != repositories.DefaultPageSize || p.NextCursor == nil {
+			t.Errorf("size %d: got %d posts, want a page of %d with a next cursor", size, len(posts), repositories.DefaultPageSize)
+		}
+	}
+	size := repositories.MaxCursorPageSize + 1
+	p, err := repositories.NewCursorPagination(&size, nil, nil, "posts.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit := p.GetLimit(); limit != repositories.MaxCursorPageSize {
+		t.Errorf("size %d: limit %d, want %d", size, limit, repositories.MaxCursorPageSize)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	router, repository := newService(t)
+	post := createPosts(t, repository, 1)[0]
+	target := "/post/" + *post.Id + "/purge"
+
+	if recorder := request(router, http.MethodDelete, target); recorder.Code != http.StatusNoContent {
+		t.Fatalf("purge: status %d, want %d: %s", recorder.Code, http.StatusNoContent, recorder.Body)
+	}
+	for _, target := range []string{target, "/post/00000000-0000-0000-0000-000000000000/purge"} {
+		if recorder := request(router, http.MethodDelete, target); recorder.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want %d: %s", target, recorder.Code, http.StatusNotFound, recorder.Body)
+		}
+	}
+}
+
+func TestEnumFilters(t *testing.T) {
+	router, repository := newService(t)
+	createPosts(t, repository, 1)
+
+	for _, query := range []string{"level=z", "level[ne]=z", "level[in]=draft,z"} {
+		if recorder := request(router, http.MethodGet, "/post?"+query); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d: %s", query, recorder.Code, http.StatusBadRequest, recorder.Body)
+		}
+	}
+	for _, query := range []string{"level=draft", "level[in]=draft,published"} {
+		if recorder := request(router, http.MethodGet, "/post?"+query); recorder.Code != http.StatusOK {
+			t.Errorf("%s: status %d, want %d: %s", query, recorder.Code, http.StatusOK, recorder.Body)
+		}
+	}
+}
+
+func TestDateFilters(t *testing.T) {
+	router, repository := newService(t)
+	posts := createPosts(t, repository, 2)
+	publishedAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := repository.Update(*posts[0].Id, &dto.PostUpdate{BasePostUpdate: dto.BasePostUpdate{PublishedAt: &publishedAt}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		count int
+	}{
+		{"publishedAt[gt]=2020-01-01", 1},
+		{"publishedAt[gt]=2020-01-01T00:00:00Z", 1},
+		{"publishedAt[lt]=2021-06-01", 0},
+		{"publishedAt[lte]=2021-06-02", 1},
+	}
+	for _, tt := range tests {
+		recorder := request(router, http.MethodGet, "/post?"+tt.query)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%s: status %d, want %d: %s", tt.query, recorder.Code, http.StatusOK, recorder.Body)
+			continue
+		}
+		var page struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Items) != tt.count {
+			t.Errorf("%s: %d posts, want %d", tt.query, len(page.Items), tt.count)
+		}
+	}
+	if recorder := request(router, http.MethodGet, "/post?publishedAt[gt]=2020-13-01"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("invalid date: status %d, want %d: %s", recorder.Code, http.StatusBadRequest, recorder.Body)
+	}
+}
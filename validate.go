@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/inflection"
+	"github.com/samber/lo"
+)
+
+// schemaLocation records where an entity was read from so diagnostics can point
+// at it. Pointer is the entity's JSON pointer within File; Fields and Relations
+// hold explicit pointers when the input doesn't use fields/<i> and relations/<i>.
+type schemaLocation struct {
+	File      string
+	Pointer   string
+	Fields    []string
+	Relations []string
+}
+
+// String formats the location of the entity as file#pointer, as diagnostics do
+func (l schemaLocation) String() string {
+	return l.File + "#" + l.Pointer
+}
+
+func (l schemaLocation) field(index int) string {
+	if index < len(l.Fields) {
+		return l.Fields[index]
+	}
+	return fmt.Sprintf("%s/fields/%d", l.Pointer, index)
+}
+
+func (l schemaLocation) relation(index int) string {
+	if index < len(l.Relations) {
+		return l.Relations[index]
+	}
+	return fmt.Sprintf("%s/relations/%d", l.Pointer, index)
+}
+
+// jsonPointerToken escapes a key for use in a JSON pointer (RFC 6901)
+func jsonPointerToken(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+type diagnostic struct {
+	Warning bool
+	File    string
+	Pointer string
+	Entity  string
+	Message string
+}
+
+func (d diagnostic) String() string {
+	severity := "error"
+	if d.Warning {
+		severity = "warning"
+	}
+	return fmt.Sprintf("%s#%s: %s: %s: %s", d.File, d.Pointer, severity, d.Entity, d.Message)
+}
+
+var (
+	relationTypes = []string{"OneToOne", "ManyToOne", "OneToMany", "ManyToMany"}
+	httpMethods   = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+	identifier    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+)
+
+// validateEntities checks the merged schema before any code is generated and
+// returns every problem found. Errors stop generation, warnings don't.
+func validateEntities(entities []Entity) []diagnostic {
+	var diagnostics []diagnostic
+
+	byName := make(map[string]*Entity)
+	for i := range entities {
+		byName[entities[i].EntityName] = &entities[i]
+	}
+
+	for i := range entities {
+		entity := &entities[i]
+		at := entity.source
+		name := lo.CoalesceOrEmpty(entity.EntityName, "entity "+strconv.Itoa(i))
+		report := func(warning bool, pointer, format string, args ...interface{}) {
+			diagnostics = append(diagnostics, diagnostic{
+				Warning: warning,
+				File:    at.File,
+				Pointer: pointer,
+				Entity:  name,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		if !identifier.MatchString(entity.EntityName) {
+			report(false, at.Pointer+"/entityName", "entityName %q is not a valid Go identifier", entity.EntityName)
+		}
+
+		names := make(map[string]string)
+		for j, field := range entity.Fields {
+			pointer := at.field(j)
+			label := fmt.Sprintf("field %d (%s)", j, field.FieldName)
+
+			if !identifier.MatchString(field.FieldName) {
+				report(false, pointer+"/fieldName", "field %d: fieldName %q is not a valid Go identifier", j, field.FieldName)
+			} else if previous, exists := names[strings.ToLower(field.FieldName)]; exists {
+				report(false, pointer+"/fieldName", "%s: duplicates %s", label, previous)
+			} else {
+				names[strings.ToLower(field.FieldName)] = label
+			}
+
+			if convertTypeScriptTypeToGo(field.FieldType) == "interface{}" {
+				report(false, pointer+"/fieldType", "%s: unknown fieldType %q", label, field.FieldType)
+			}
+			if strings.EqualFold(field.FieldType, "enum") && len(field.Values) == 0 {
+				report(false, pointer+"/values", "%s: enum field needs a values list", label)
+			}
+			if field.EnumConstraint != "" && field.EnumConstraint != "check" && field.EnumConstraint != "native" {
+				report(false, pointer+"/enumConstraint", "%s: enumConstraint must be \"check\" or \"native\", got %q", label, field.EnumConstraint)
+			}
+			if field.Pattern != "" {
+				if _, err := regexp.Compile(field.Pattern); err != nil {
+					report(false, pointer+"/pattern", "%s: invalid pattern: %v", label, err)
+				}
+			}
+			if field.Sortable {
+				if field.Virtual {
+					report(false, pointer+"/sortable", "%s: a virtual field has no column to sort by", label)
+				} else if !entity.AdditionalFeatures.Sorting {
+					report(true, pointer+"/sortable", "%s: sortable has no effect unless additionalFeatures.sorting is on", label)
+				}
+			}
+			if field.Primary {
+				if !lo.Contains(primaryKeyFieldTypes, strings.ToLower(field.FieldType)) {
+					report(false, pointer+"/fieldType", "%s: a primary key must have one of the fieldTypes %s, got %q", label, strings.Join(primaryKeyFieldTypes, ", "), field.FieldType)
+				}
+			}
+		}
+
+		for j, relation := range entity.Relations {
+			pointer := at.relation(j)
+			label := fmt.Sprintf("relation %d (%s)", j, relation.FieldName)
+
+			if !identifier.MatchString(relation.FieldName) {
+				report(false, pointer+"/fieldName", "relation %d: fieldName %q is not a valid Go identifier", j, relation.FieldName)
+			} else if previous, exists := names[strings.ToLower(relation.FieldName)]; exists {
+				report(false, pointer+"/fieldName", "%s: duplicates %s", label, previous)
+			} else {
+				names[strings.ToLower(relation.FieldName)] = label
+			}
+
+			if !lo.Contains(relationTypes, relation.RelationType) {
+				report(false, pointer+"/relationType", "%s: unknown relationType %q, expected one of %s", label, relation.RelationType, strings.Join(relationTypes, ", "))
+			}
+			if relation.DeleteBehavior != "" {
+				report(true, pointer+"/deleteBehavior", "%s: deleteBehavior is deprecated and ignored, set cascade instead", label)
+			}
+
+			related, exists := byName[relation.RelatedEntity]
+			if !exists {
+				report(false, pointer+"/relatedEntity", "%s: relatedEntity %q is not defined", label, relation.RelatedEntity)
+				continue
+			}
+
+			// The foreign keys of a relation reference a single key column
+			referenced := related
+			if relation.RelationType == "OneToMany" || (relation.RelationType == "OneToOne" && relation.OneToOneOwner) ||
+				(relation.RelationType == "ManyToMany" && entity.HasCompositePrimaryKey()) {
+				referenced = entity
+			}
+			if referenced.HasCompositePrimaryKey() {
+				report(false, pointer, "%s: %s has a composite primary key, which foreign keys can't reference", label, referenced.EntityName)
+			}
+
+			if relation.RelationType == "OneToMany" && !relation.Cascade {
+				foreignKey := relation.ForeignKey
+				if back, ok := lo.Find(related.Relations, func(r Relation) bool { return r.RelatedEntity == entity.EntityName }); ok && foreignKey == "" {
+					foreignKey = back.FieldName
+				}
+				column := foreignKeyColumn(lo.CamelCase(lo.CoalesceOrEmpty(foreignKey, entity.EntityName)))
+				if key, ok := lo.Find(related.Fields, func(f Field) bool { return f.Primary && lo.SnakeCase(f.FieldName) == column }); ok {
+					report(false, pointer+"/cascade", "%s: %s.%s is part of the primary key and can't be set to null on delete; set cascade", label, related.EntityName, key.FieldName)
+				}
+			}
+
+			if relation.RelationType == "OneToMany" || relation.RelationType == "ManyToMany" {
+				if param := inflection.Singular(relation.FieldName) + "ID"; entity.queryFieldNames()[toGoFieldName(param)] {
+					report(true, pointer, "%s: the %s membership filter clashes with another query parameter and is left out", label, param)
+				}
+			}
+
+			// Mirrors AssignRelations: without a foreignKey the inverse relation supplies it
+			if relation.ForeignKey == "" && relation.RelationType != "ManyToMany" && !lo.SomeBy(related.Relations, func(r Relation) bool { return r.RelatedEntity == entity.EntityName }) {
+				report(true, pointer, "%s: %s has no relation back to %s, so the foreign key can't be paired; set foreignKey explicitly", label, related.EntityName, entity.EntityName)
+			}
+		}
+
+		if mode := entity.AdditionalFeatures.Pagination; mode != "" && !lo.Contains(paginationModes, mode) {
+			report(false, at.Pointer+"/additionalFeatures/pagination", "pagination must be \"offset\" or \"cursor\", got %q", mode)
+		}
+
+		if depth := entity.AdditionalFeatures.PreloadDepth; depth != nil && *depth < 0 {
+			report(false, at.Pointer+"/additionalFeatures/preloadDepth", "preloadDepth must not be negative, got %d", *depth)
+		}
+
+		endpoints := entity.Endpoints()
+		for j, endpoint := range entity.CustomEndpoints {
+			pointer := fmt.Sprintf("%s/customEndpoints/%d", at.Pointer, j)
+			if !identifier.MatchString(endpoint.EndpointName) {
+				report(false, pointer+"/endpointName", "custom endpoint %d: endpointName %q is not a valid Go identifier", j, endpoint.EndpointName)
+			} else if lo.Count(endpoints, endpoint.EndpointName) > 1 {
+				report(false, pointer+"/endpointName", "custom endpoint %d: %s clashes with another handler", j, endpoint.EndpointName)
+			}
+			if !lo.Contains(httpMethods, endpoint.HTTPMethod) {
+				report(false, pointer+"/httpMethod", "custom endpoint %d (%s): httpMethod must be one of %s, got %q", j, endpoint.EndpointName, strings.Join(httpMethods, ", "), endpoint.HTTPMethod)
+			}
+		}
+
+		overrides := lo.Keys(entity.AdditionalFeatures.EndpointAuthentication)
+		sort.Strings(overrides)
+		for _, endpoint := range overrides {
+			if !lo.Contains(endpoints, endpoint) {
+				report(false, at.Pointer+"/additionalFeatures/endpointAuthentication/"+jsonPointerToken(endpoint), "endpointAuthentication names unknown handler %q", endpoint)
+			}
+		}
+	}
+
+	return diagnostics
+}
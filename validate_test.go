@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// parseTestInput writes input to a schema file named name and parses it, so the
+// entities carry the JSON pointers a real input file gives them
+func parseTestInput(t *testing.T, name, input string) []Entity {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entities, err := parseInputFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range entities {
+		entities[i].source.File = name
+	}
+	return entities
+}
+
+func TestValidateEntities(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name: "valid",
+			input: `[
+				{"entityName": "Course", "fields": [{"fieldName": "title", "fieldType": "string"}],
+				 "relations": [{"relationType": "ManyToOne", "relatedEntity": "Teacher", "fieldName": "teacher"}]},
+				{"entityName": "Teacher", "fields": [{"fieldName": "name", "fieldType": "string"}],
+				 "relations": [{"relationType": "OneToMany", "relatedEntity": "Course", "fieldName": "courses"}]}
+			]`,
+		},
+		{
+			name:  "entity name",
+			input: `{"entityName": "my-course", "fields": []}`,
+			want:  []string{`s.json#/entityName: error: my-course: entityName "my-course" is not a valid Go identifier`},
+		},
+		{
+			name: "fields",
+			input: `[{"entityName": "Course", "fields": [
+				{"fieldName": "title", "fieldType": "string"},
+				{"fieldName": "Title", "fieldType": "string"},
+				{"fieldName": "credits", "fieldType": "numbr"},
+				{"fieldName": "level", "fieldType": "enum"},
+				{"fieldName": "code", "fieldType": "string", "pattern": "("},
+				{"fieldName": "rank", "fieldType": "int", "sortable": true},
+				{"fieldName": "key", "fieldType": "boolean", "primary": true}
+			]}]`,
+			want: []string{
+				`s.json#/0/fields/1/fieldName: error: Course: field 1 (Title): duplicates field 0 (title)`,
+				`s.json#/0/fields/2/fieldType: error: Course: field 2 (credits): unknown fieldType "numbr"`,
+				`s.json#/0/fields/3/values: error: Course: field 3 (level): enum field needs a values list`,
+				"s.json#/0/fields/4/pattern: error: Course: field 4 (code): invalid pattern: error parsing regexp: missing closing ): `(`",
+				`s.json#/0/fields/5/sortable: warning: Course: field 5 (rank): sortable has no effect unless additionalFeatures.sorting is on`,
+				`s.json#/0/fields/6/fieldType: error: Course: field 6 (key): a primary key must have one of the fieldTypes uuid, string, ulid, number, int, integer, uint, uint64, bigint, got "boolean"`,
+			},
+		},
+		{
+			name: "relations",
+			input: `[{"entityName": "Course", "fields": [{"fieldName": "title", "fieldType": "string"}], "relations": [
+				{"relationType": "ManyToOne", "relatedEntity": "Teacher", "fieldName": "teacher", "deleteBehavior": "CASCADE"},
+				{"relationType": "ManyToSome", "relatedEntity": "Course", "fieldName": "prerequisite", "foreignKey": "prerequisite"},
+				{"relationType": "ManyToOne", "relatedEntity": "Course", "fieldName": "title", "foreignKey": "title"}
+			]}]`,
+			want: []string{
+				`s.json#/0/relations/0/deleteBehavior: warning: Course: relation 0 (teacher): deleteBehavior is deprecated and ignored, set cascade instead`,
+				`s.json#/0/relations/0/relatedEntity: error: Course: relation 0 (teacher): relatedEntity "Teacher" is not defined`,
+				`s.json#/0/relations/1/relationType: error: Course: relation 1 (prerequisite): unknown relationType "ManyToSome", expected one of OneToOne, ManyToOne, OneToMany, ManyToMany`,
+				`s.json#/0/relations/2/fieldName: error: Course: relation 2 (title): duplicates field 0 (title)`,
+			},
+		},
+		{
+			name: "missing back relation",
+			input: `[
+				{"entityName": "Course", "fields": [], "relations": [{"relationType": "ManyToOne", "relatedEntity": "Teacher", "fieldName": "teacher"}]},
+				{"entityName": "Teacher", "fields": []}
+			]`,
+			want: []string{`s.json#/0/relations/0: warning: Course: relation 0 (teacher): Teacher has no relation back to Course, so the foreign key can't be paired; set foreignKey explicitly`},
+		},
+		{
+			name: "additional features",
+			input: `{"entityName": "Course", "fields": [], "additionalFeatures": {
+				"pagination": "keyset", "preloadDepth": -1, "endpointAuthentication": {"Archive": true, "a/b": true}}}`,
+			want: []string{
+				`s.json#/additionalFeatures/pagination: error: Course: pagination must be "offset" or "cursor", got "keyset"`,
+				`s.json#/additionalFeatures/preloadDepth: error: Course: preloadDepth must not be negative, got -1`,
+				`s.json#/additionalFeatures/endpointAuthentication/Archive: error: Course: endpointAuthentication names unknown handler "Archive"`,
+				`s.json#/additionalFeatures/endpointAuthentication/a~1b: error: Course: endpointAuthentication names unknown handler "a/b"`,
+			},
+		},
+		{
+			name: "custom endpoints",
+			input: `{"entityName": "Course", "fields": [], "customEndpoints": [
+				{"endpointName": "GetAll", "httpMethod": "GET", "path": "/all"},
+				{"endpointName": "archive-all", "httpMethod": "FETCH", "path": "/archive"}
+			]}`,
+			want: []string{
+				`s.json#/customEndpoints/0/endpointName: error: Course: custom endpoint 0: GetAll clashes with another handler`,
+				`s.json#/customEndpoints/1/endpointName: error: Course: custom endpoint 1: endpointName "archive-all" is not a valid Go identifier`,
+				`s.json#/customEndpoints/1/httpMethod: error: Course: custom endpoint 1 (archive-all): httpMethod must be one of GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS, got "FETCH"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range validateEntities(parseTestInput(t, "s.json", tt.input)) {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diagnostics:\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEntitiesDesignSchemaPointers(t *testing.T) {
+	entities := parseTestInput(t, "design.json", `{
+		"entities": {"Course": {"fields": {"id": {"type": "uuid", "primaryKey": true}, "credits": {"type": "numbr"}}}},
+		"relationships": [{"from": "Course", "to": "Teacher", "type": "many-to-one", "name": "teacher"}]
+	}`)
+
+	var got []string
+	for _, d := range validateEntities(entities) {
+		got = append(got, d.String())
+	}
+	want := []string{
+		`design.json#/entities/Course/fields/credits/fieldType: error: Course: field 1 (credits): unknown fieldType "numbr"`,
+		`design.json#/relationships/0/relatedEntity: error: Course: relation 0 (teacher): relatedEntity "Teacher" is not defined`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnostics:\n%q\nwant:\n%q", got, want)
+	}
+}